@@ -1,10 +1,25 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/docker-machine-driver-spotinst/spotinst"
 	"github.com/docker/machine/libmachine/drivers/plugin"
 )
 
 func main() {
+	spotinst.CancelOnSignals()
+
+	if len(os.Args) > 1 {
+		if command, ok := spotinst.Commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	plugin.RegisterDriver(spotinst.NewDriver("", ""))
 }
@@ -18,6 +18,76 @@ const (
 	// @enum InstanceStateName
 	InstanceStateNamePendingEvaluation = "pending-evaluation"
 
+	// @enum AzureNodeState
+	AzureNodeStateStarting = "starting"
+	// @enum AzureNodeState
+	AzureNodeStateRunning = "running"
+	// @enum AzureNodeState
+	AzureNodeStateStopping = "stopping"
+	// @enum AzureNodeState
+	AzureNodeStateStopped = "stopped"
+	// @enum AzureNodeState
+	AzureNodeStateDeallocating = "deallocating"
+	// @enum AzureNodeState
+	AzureNodeStateDeallocated = "deallocated"
+
+	// @enum GCPInstanceStatus
+	GCPInstanceStatusProvisioning = "PROVISIONING"
+	// @enum GCPInstanceStatus
+	GCPInstanceStatusStaging = "STAGING"
+	// @enum GCPInstanceStatus
+	GCPInstanceStatusRunning = "RUNNING"
+	// @enum GCPInstanceStatus
+	GCPInstanceStatusStopping = "STOPPING"
+	// @enum GCPInstanceStatus
+	GCPInstanceStatusStopped = "STOPPED"
+	// @enum GCPInstanceStatus
+	GCPInstanceStatusSuspending = "SUSPENDING"
+	// @enum GCPInstanceStatus
+	GCPInstanceStatusSuspended = "SUSPENDED"
+	// @enum GCPInstanceStatus
+	GCPInstanceStatusTerminated = "TERMINATED"
+
+	// @enum CloudProvider
+	CloudProviderAWS = "aws"
+	// @enum CloudProvider
+	CloudProviderAzure = "azure"
+	// @enum CloudProvider
+	CloudProviderGCP = "gcp"
+
+	// @enum StatefulInstanceState
+	StatefulInstanceStateActive = "ACTIVE"
+	// @enum StatefulInstanceState
+	StatefulInstanceStatePausing = "PAUSING"
+	// @enum StatefulInstanceState
+	StatefulInstanceStatePaused = "PAUSED"
+	// @enum StatefulInstanceState
+	StatefulInstanceStateResuming = "RESUMING"
+	// @enum StatefulInstanceState
+	StatefulInstanceStateRecycling = "RECYCLING"
+	// @enum StatefulInstanceState
+	StatefulInstanceStateDeallocating = "DEALLOCATING"
+	// @enum StatefulInstanceState
+	StatefulInstanceStateDeallocated = "DEALLOCATED"
+	// @enum StatefulInstanceState
+	StatefulInstanceStateError = "ERROR"
+
+	// @enum Backend
+	BackendElastigroup = "elastigroup"
+	// @enum Backend
+	BackendStatefulNode = "stateful-node"
+
+	// @enum CreatePhase
+	CreatePhaseGroupCreated = "group-created"
+	// @enum CreatePhase
+	CreatePhaseNodeCreated = "node-created"
+	// @enum CreatePhase
+	CreatePhaseSpotRequested = "spot-requested"
+	// @enum CreatePhase
+	CreatePhaseInstanceAssigned = "instance-assigned"
+	// @enum CreatePhase
+	CreatePhaseRunning = "running"
+
 	// @enum LogLevel
 	INFO = "info"
 	// @enum LogLevel
@@ -0,0 +1,67 @@
+package spotinst
+
+import (
+	"context"
+
+	"github.com/docker/machine/libmachine/state"
+)
+
+// backend is the Spotinst service the machine's instance comes from.
+type backend interface {
+	// Create launches the instance and waits until it is reachable.
+	Create(ctx context.Context) error
+
+	State() (state.State, error)
+
+	Start() error
+	Stop() error
+	Restart() error
+
+	// Kill forcibly stops the instance. Instances of an Elastigroup are
+	// terminated, as they cannot be stopped otherwise.
+	Kill() error
+
+	// Remove releases everything Create allocated.
+	Remove() error
+}
+
+func (d *Driver) backend() backend {
+	if d.SpotinstBackend == BackendStatefulNode {
+		return statefulNodeBackend{d}
+	}
+	return elastigroupBackend{d}
+}
+
+// elastigroupBackend gets the instance by scaling up an Elastigroup, or by
+// creating a dedicated one from a template.
+type elastigroupBackend struct {
+	*Driver
+}
+
+func (b elastigroupBackend) Create(ctx context.Context) error {
+	return b.createInElastigroup(ctx)
+}
+
+func (b elastigroupBackend) State() (state.State, error) {
+	return b.elastigroupState()
+}
+
+func (b elastigroupBackend) Start() error {
+	return b.resumeStatefulInstance()
+}
+
+func (b elastigroupBackend) Stop() error {
+	return b.pauseStatefulInstance()
+}
+
+func (b elastigroupBackend) Restart() error {
+	return b.recycleStatefulInstance()
+}
+
+func (b elastigroupBackend) Kill() error {
+	return b.detachFromElastigroup()
+}
+
+func (b elastigroupBackend) Remove() error {
+	return b.removeFromElastigroup()
+}
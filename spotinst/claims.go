@@ -0,0 +1,39 @@
+package spotinst
+
+import "strings"
+
+// claimLaunchedInstance resolves requestID to an instance no other machine claimed.
+func (d *Driver) claimLaunchedInstance(p provider, instances []*instance, requestID string) (*instance, error) {
+	if d.StorePath == "" || !strings.HasPrefix(requestID, launchedAfterPrefix) {
+		return p.FindRequest(instances, requestID)
+	}
+
+	var found *instance
+	err := d.updateInstanceRecords(d.SpotinstElastiGroupID, func(records map[string]map[string]string) error {
+		var unclaimed []*instance
+		for _, v := range instances {
+			if owner := records[v.ID][machineIdTagKey]; owner != "" && owner != d.Id {
+				continue
+			}
+			unclaimed = append(unclaimed, v)
+		}
+
+		var err error
+		found, err = p.FindRequest(unclaimed, requestID)
+		if err != nil || found == nil {
+			return err
+		}
+
+		pruneRecords(records, instances)
+		setRecord(records, found.ID, map[string]string{machineIdTagKey: d.Id})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if found != nil {
+		stdLog(DEBUG, "Claimed instance %v for request %v", found.ID, requestID)
+	}
+	return found, nil
+}
@@ -0,0 +1,54 @@
+package spotinst
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+)
+
+func TestConcurrentCreatesClaimDistinctInstances(t *testing.T) {
+	const machines = 4
+
+	for _, provider := range []string{CloudProviderAzure, CloudProviderGCP} {
+		t.Run(provider, func(t *testing.T) {
+			env := newTestEnv(t)
+			defer env.Close()
+			for i := 0; i < machines; i++ {
+				env.srv.Script(testGroupID, spotinsttest.SpotRequest{Delay: i % 2})
+			}
+
+			drivers := make([]*Driver, machines)
+			errs := make([]error, machines)
+			var wg sync.WaitGroup
+			for i := range drivers {
+				drivers[i] = env.driver(fmt.Sprintf("m%d", i))
+				drivers[i].SpotinstCloudProvider = provider
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs[i] = drivers[i].Create()
+				}(i)
+			}
+			wg.Wait()
+
+			owners := make(map[string]string)
+			for i, d := range drivers {
+				if errs[i] != nil {
+					t.Fatalf("%v: %v", d.MachineName, errs[i])
+				}
+				if d.InstanceId == nil {
+					t.Fatalf("%v has no instance", d.MachineName)
+				}
+				if other, ok := owners[*d.InstanceId]; ok {
+					t.Errorf("%v and %v both took instance %v", other, d.MachineName, *d.InstanceId)
+				}
+				owners[*d.InstanceId] = d.MachineName
+			}
+			if g := env.group(t); g.Target != machines || len(g.Instances) != machines {
+				t.Errorf("group has target %v and %v instances, want %v and %v", g.Target, len(g.Instances), machines, machines)
+			}
+		})
+	}
+}
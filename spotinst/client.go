@@ -0,0 +1,112 @@
+package spotinst
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/spotinst/spotinst-sdk-go/service/elastigroup"
+	"github.com/spotinst/spotinst-sdk-go/service/elastigroup/providers/aws"
+	"github.com/spotinst/spotinst-sdk-go/service/elastigroup/providers/azure"
+	"github.com/spotinst/spotinst-sdk-go/service/elastigroup/providers/gcp"
+	"github.com/spotinst/spotinst-sdk-go/service/managedinstance"
+	mi "github.com/spotinst/spotinst-sdk-go/service/managedinstance/providers/aws"
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+	"github.com/spotinst/spotinst-sdk-go/spotinst/client"
+	"github.com/spotinst/spotinst-sdk-go/spotinst/session"
+	"github.com/spotinst/spotinst-sdk-go/spotinst/util/uritemplates"
+)
+
+// Client provides the Spotinst API operations used by the driver.
+type Client interface {
+	CloudProviderAWS() aws.Service
+	CloudProviderAzure() azure.Service
+	CloudProviderGCP() gcp.Service
+
+	// StatefulNodeAWS provides the AWS stateful node, formerly managed
+	// instance, operations.
+	StatefulNodeAWS() mi.Service
+
+	// ScaleGCPGroup scales a GCP group up or down by adjustment instances.
+	ScaleGCPGroup(ctx context.Context, groupID, scaleType string, adjustment int) error
+
+	// DetachGCPInstances detaches and terminates instances of a GCP group,
+	// decrementing its target capacity.
+	DetachGCPInstances(ctx context.Context, groupID string, instanceNames []string) error
+}
+
+type apiClient struct {
+	elastigroup     elastigroup.Service
+	managedinstance managedinstance.Service
+	http            *client.Client
+}
+
+// NewClient returns a Client for the Spotinst API described by config.
+func NewClient(config *spotinst.Config) Client {
+	// Create a new session.
+	sess := session.New(config)
+
+	// Create a new client.
+	return &apiClient{
+		elastigroup:     elastigroup.New(sess),
+		managedinstance: managedinstance.New(sess),
+		http:            client.New(sess.Config),
+	}
+}
+
+func (c *apiClient) CloudProviderAWS() aws.Service {
+	return c.elastigroup.CloudProviderAWS()
+}
+
+func (c *apiClient) CloudProviderAzure() azure.Service {
+	return c.elastigroup.CloudProviderAzure()
+}
+
+func (c *apiClient) CloudProviderGCP() gcp.Service {
+	return c.elastigroup.CloudProviderGCP()
+}
+
+func (c *apiClient) StatefulNodeAWS() mi.Service {
+	return c.managedinstance.CloudProviderAWS()
+}
+
+func (c *apiClient) ScaleGCPGroup(ctx context.Context, groupID, scaleType string, adjustment int) error {
+	path, err := uritemplates.Expand("/gcp/gce/group/{groupId}/scale/{type}", uritemplates.Values{
+		"groupId": groupID,
+		"type":    scaleType,
+	})
+	if err != nil {
+		return err
+	}
+
+	r := client.NewRequest(http.MethodPut, path)
+	r.Params.Set("adjustment", strconv.Itoa(adjustment))
+
+	resp, err := client.RequireOK(c.http.Do(ctx, r))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *apiClient) DetachGCPInstances(ctx context.Context, groupID string, instanceNames []string) error {
+	path, err := uritemplates.Expand("/gcp/gce/group/{groupId}/detachInstances", uritemplates.Values{
+		"groupId": groupID,
+	})
+	if err != nil {
+		return err
+	}
+
+	r := client.NewRequest(http.MethodPut, path)
+	r.Obj = struct {
+		InstanceNames                 []string `json:"instancesToDetach"`
+		ShouldDecrementTargetCapacity bool     `json:"shouldDecrementTargetCapacity"`
+		ShouldTerminateInstances      bool     `json:"shouldTerminateInstances"`
+	}{instanceNames, true, true}
+
+	resp, err := client.RequireOK(c.http.Do(ctx, r))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
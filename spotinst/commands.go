@@ -0,0 +1,148 @@
+package spotinst
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/machine/libmachine/mcnflag"
+)
+
+// Commands are the subcommands the driver binary runs, by name, instead of
+// serving the plugin. They take the --spotinst-* flags of the driver, which
+// also default to their environment variables.
+var Commands = map[string]func(args []string) error{
+	"refill-pool": refillPoolCommand,
+	"gc":          gcCommand,
+	"reap":        reapCommand,
+}
+
+// refillPoolCommand scales the group up until its warm pool has --size
+// unclaimed instances.
+func refillPoolCommand(args []string) error {
+	fs := flag.NewFlagSet("refill-pool", flag.ContinueOnError)
+	size := fs.Int("size", 0, "number of unclaimed instances the warm pool should have")
+	storePath := fs.String("storage-path", defaultStorePath(), "docker-machine store whose creates claim the pool")
+
+	d, err := commandDriver(fs, args)
+	if err != nil {
+		return err
+	}
+	d.StorePath = *storePath
+	if *size <= 0 {
+		return errors.New(tag + "The size of the warm pool must be positive")
+	}
+	if err := d.checkWarmPool(); err != nil {
+		return err
+	}
+	if err := d.resolveElastiGroup(); err != nil {
+		return err
+	}
+
+	ctx, cancel := d.createContext()
+	defer cancel()
+	return d.refillPool(ctx, *size)
+}
+
+// commandDriver parses the driver flags of a subcommand along with its own
+// flags in fs and returns the driver they configure.
+func commandDriver(fs *flag.FlagSet, args []string) (*Driver, error) {
+	d := NewDriver("", "")
+	opts := newCommandOptions(fs, d.GetCreateFlags())
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf(tag+"Unexpected arguments %v", strings.Join(fs.Args(), " "))
+	}
+	if err := d.SetConfigFromFlags(opts); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// commandOptions are the driver flags of a subcommand as DriverOptions.
+type commandOptions map[string]interface{}
+
+func newCommandOptions(fs *flag.FlagSet, flags []mcnflag.Flag) commandOptions {
+	opts := make(commandOptions)
+	for _, f := range flags {
+		switch f := f.(type) {
+		case mcnflag.StringFlag:
+			value := f.Value
+			if env := os.Getenv(f.EnvVar); f.EnvVar != "" && env != "" {
+				value = env
+			}
+			opts[f.Name] = fs.String(f.Name, value, f.Usage)
+		case mcnflag.IntFlag:
+			value := f.Value
+			if env := os.Getenv(f.EnvVar); f.EnvVar != "" && env != "" {
+				fmt.Sscan(env, &value)
+			}
+			opts[f.Name] = fs.Int(f.Name, value, f.Usage)
+		case mcnflag.BoolFlag:
+			value := f.EnvVar != "" && os.Getenv(f.EnvVar) != ""
+			opts[f.Name] = fs.Bool(f.Name, value, f.Usage)
+		case mcnflag.StringSliceFlag:
+			value := &stringSlice{values: f.Value}
+			if env := os.Getenv(f.EnvVar); f.EnvVar != "" && env != "" {
+				value.values = strings.Split(env, ",")
+			}
+			fs.Var(value, f.Name, f.Usage)
+			opts[f.Name] = value
+		}
+	}
+	return opts
+}
+
+func (o commandOptions) String(key string) string {
+	if v, ok := o[key].(*string); ok {
+		return *v
+	}
+	return ""
+}
+
+func (o commandOptions) StringSlice(key string) []string {
+	if v, ok := o[key].(*stringSlice); ok {
+		return v.values
+	}
+	return nil
+}
+
+func (o commandOptions) Int(key string) int {
+	if v, ok := o[key].(*int); ok {
+		return *v
+	}
+	return 0
+}
+
+func (o commandOptions) Bool(key string) bool {
+	if v, ok := o[key].(*bool); ok {
+		return *v
+	}
+	return false
+}
+
+// stringSlice is a repeatable flag. Given on the command line, it replaces the
+// values of its environment variable.
+type stringSlice struct {
+	values []string
+	set    bool
+}
+
+func (s *stringSlice) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(s.values, ",")
+}
+
+func (s *stringSlice) Set(value string) error {
+	if !s.set {
+		s.values, s.set = nil, true
+	}
+	s.values = append(s.values, value)
+	return nil
+}
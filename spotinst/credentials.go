@@ -0,0 +1,190 @@
+package spotinst
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spotinst/spotinst-sdk-go/spotinst/credentials"
+)
+
+const (
+	credentialProcessProviderName = "CredentialProcessProvider"
+
+	// credentialExpiryWindow is how long before their expiration the
+	// credentials of a credential process are renewed.
+	credentialExpiryWindow = 30 * time.Second
+)
+
+// credentialsChain returns the providers the Spotinst credentials are looked
+// up through. With --spotinst-credential-process only that command is used,
+// and with --spotinst-profile only that profile of the credentials file; in
+// both cases --spotinst-account, if given, overrides their account. A token
+// saved encrypted is the only one used. Otherwise the token and account flags
+// come first, then the environment and the default profile of the credentials
+// file.
+//
+// The credentials are kept for the life of the driver, so that a credential
+// process runs once rather than for every API call.
+func (d *Driver) credentialsChain() *credentials.Credentials {
+	if d.credentials != nil {
+		return d.credentials
+	}
+
+	switch {
+	case d.SpotinstCredentialProcess != "":
+		d.credentialProcess = &processProvider{command: d.SpotinstCredentialProcess}
+		d.credentials = credentials.NewCredentials(&accountProvider{
+			Provider: d.credentialProcess,
+			account:  d.SpotinstAccount,
+		})
+	case d.SpotinstProfile != "":
+		d.credentials = credentials.NewCredentials(&accountProvider{
+			Provider: &credentials.FileProvider{Profile: d.SpotinstProfile},
+			account:  d.SpotinstAccount,
+		})
+	case strings.HasPrefix(d.SpotinstToken, encryptedTokenPrefix):
+		d.credentials = credentials.NewCredentials(&tokenProvider{d})
+	default:
+		d.credentials = credentials.NewChainCredentials(
+			&tokenProvider{d},
+			new(credentials.EnvProvider),
+			new(credentials.FileProvider),
+		)
+	}
+	return d.credentials
+}
+
+// accountProvider sets the account of the credentials retrieved by another
+// provider.
+type accountProvider struct {
+	credentials.Provider
+	account string
+}
+
+func (p *accountProvider) Retrieve() (credentials.Value, error) {
+	value, err := p.Provider.Retrieve()
+	if err == nil && p.account != "" {
+		value.Account = p.account
+	}
+	return value, err
+}
+
+// processProvider retrieves the credentials by running a command, in the style
+// of the AWS credential_process setting. The command prints a JSON object with
+// the token, and optionally the account and an RFC 3339 expiration.
+type processProvider struct {
+	command    string
+	expiration time.Time
+}
+
+func (p *processProvider) Retrieve() (credentials.Value, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", p.command)
+	} else {
+		cmd = exec.Command("sh", "-c", p.command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("credential process failed: %v: %v", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var result struct {
+		Token      string     `json:"token"`
+		Account    string     `json:"account"`
+		Expiration *time.Time `json:"expiration"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return credentials.Value{}, fmt.Errorf("credential process printed invalid JSON: %v", err)
+	}
+	if result.Token == "" {
+		return credentials.Value{}, errors.New("credential process printed no token")
+	}
+
+	p.expiration = time.Time{}
+	if result.Expiration != nil {
+		p.expiration = *result.Expiration
+	}
+
+	stdLog(DEBUG, "Retrieved credentials from credential process, expiring %v", p.expiration)
+	return credentials.Value{
+		Token:        result.Token,
+		Account:      result.Account,
+		ProviderName: credentialProcessProviderName,
+	}, nil
+}
+
+func (p *processProvider) String() string { return credentialProcessProviderName }
+
+func (p *processProvider) expired() bool {
+	return !p.expiration.IsZero() && time.Now().Add(credentialExpiryWindow).After(p.expiration)
+}
+
+// credentialProcessTransport renews the credentials of a credential process
+// when they expire, and once more when the API rejects them, re-sending the
+// request with the new ones.
+type credentialProcessTransport struct {
+	base        http.RoundTripper
+	credentials *credentials.Credentials
+	process     *processProvider
+}
+
+func (t *credentialProcessTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.process.expired() {
+		t.credentials.Refresh()
+		authorized, err := t.authorize(req)
+		if err != nil {
+			return nil, err
+		}
+		req = authorized
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	stdLog(DEBUG, "Credentials rejected, running the credential process again")
+	t.credentials.Refresh()
+	retry, err := t.authorize(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(retry)
+}
+
+// authorize returns a copy of req with the current credentials.
+func (t *credentialProcessTransport) authorize(req *http.Request) (*http.Request, error) {
+	value, err := t.credentials.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	out := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if out.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	out.Header.Set("Authorization", "Bearer "+value.Token)
+	if value.Account != "" {
+		query := out.URL.Query()
+		query.Set("accountId", value.Account)
+		out.URL.RawQuery = query.Encode()
+	}
+	return out, nil
+}
@@ -0,0 +1,81 @@
+package spotinst
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+)
+
+func TestCredentialProcessKeptInMemory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential process is a shell script")
+	}
+
+	env := newTestEnv(t)
+	defer env.Close()
+
+	// The first run prints a token the API rejects.
+	runs := filepath.Join(env.store, "runs")
+	command := `echo run >> ` + runs + `
+if [ "$(wc -l < ` + runs + `)" -eq 1 ]; then token=stale; else token=` + spotinsttest.Token + `; fi
+echo "{\"token\": \"$token\", \"account\": \"` + spotinsttest.Account + `\"}"`
+
+	d := env.driver("m1")
+	d.SpotinstToken = ""
+	d.SpotinstAccount = ""
+	d.SpotinstCredentialProcess = command
+	for i := 0; i < 3; i++ {
+		if _, err := d.groupStatus(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, _ := ioutil.ReadFile(runs)
+	if n := strings.Count(string(b), "run"); n != 2 {
+		t.Fatalf("credential process ran %v times, want once and once more for the rejected token", n)
+	}
+
+	err := filepath.Walk(env.store, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || path == runs {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err == nil && strings.Contains(string(b), spotinsttest.Token) {
+			t.Errorf("token of the credential process was written to %v", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCredentialProcessRenewsExpiredToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential process is a shell script")
+	}
+
+	d := NewDriver("m1", "")
+	d.SpotinstCredentialProcess = `echo '{"token": "old", "expiration": "2000-01-01T00:00:00Z"}'`
+	if _, err := d.credentialsChain().Get(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.credentialProcess.expired() {
+		t.Fatal("credentials past their expiration not reported expired")
+	}
+
+	d.credentialProcess.command = `echo '{"token": "new", "expiration": "2999-01-01T00:00:00Z"}'`
+	d.credentials.Refresh()
+	value, err := d.credentials.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.Token != "new" || d.credentialProcess.expired() {
+		t.Fatalf("got token %q, expired %v, want the new unexpired token", value.Token, d.credentialProcess.expired())
+	}
+}
@@ -0,0 +1,114 @@
+package spotinst
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	expiresAtTagKey = "docker-machine-expires-at"
+
+	// expiryWarning is how long before its expiry GetState starts warning
+	// about a machine.
+	expiryWarning = time.Hour
+)
+
+// parseExpiry returns when the machine expires from --spotinst-ttl, counted
+// from now, or --spotinst-expires-at. It returns the zero time if neither is
+// set.
+func parseExpiry(ttl, expiresAt string) (time.Time, error) {
+	switch {
+	case ttl != "" && expiresAt != "":
+		return time.Time{}, errors.New(tag + "Spotinst TTL and expiry time are mutually exclusive")
+	case ttl != "":
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf(tag+"Invalid TTL %q, must be a positive duration such as 8h", ttl)
+		}
+		return time.Now().Add(d).UTC().Truncate(time.Second), nil
+	case expiresAt != "":
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return time.Time{}, fmt.Errorf(tag+"Invalid expiry time %q, must be RFC 3339 such as 2006-01-02T15:04:05Z", expiresAt)
+		}
+		if !t.After(time.Now()) {
+			return time.Time{}, fmt.Errorf(tag+"Expiry time %v is in the past", expiresAt)
+		}
+		return t.UTC(), nil
+	default:
+		return time.Time{}, nil
+	}
+}
+
+func (d *Driver) expired() bool {
+	return !d.ExpiresAt.IsZero() && !time.Now().Before(d.ExpiresAt)
+}
+
+// warnExpiry warns when the machine has expired or is about to.
+func (d *Driver) warnExpiry() {
+	if d.ExpiresAt.IsZero() {
+		return
+	}
+	left := time.Until(d.ExpiresAt)
+	switch {
+	case left <= 0:
+		stdLog(WARN, "Machine %v expired at %v and will be removed by reap", d.MachineName, d.ExpiresAt.Format(time.RFC3339))
+	case left < expiryWarning:
+		stdLog(WARN, "Machine %v expires in %v, at %v", d.MachineName, left.Round(time.Second), d.ExpiresAt.Format(time.RFC3339))
+	}
+}
+
+// reapCommand removes the expired machines of a docker-machine store, both
+// from Spotinst and from the store.
+func reapCommand(args []string) error {
+	fs := flag.NewFlagSet("reap", flag.ContinueOnError)
+	storePath := fs.String("storage-path", defaultStorePath(), "docker-machine store to remove the expired machines of")
+	dryRun := fs.Bool("dry-run", false, "only list the expired machines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf(tag+"Unexpected arguments %v", strings.Join(fs.Args(), " "))
+	}
+
+	machines, err := loadMachines(*storePath)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	reaped := 0
+	for _, d := range machines {
+		if !d.expired() {
+			continue
+		}
+		reaped++
+		if *dryRun {
+			fmt.Printf("%v expired at %v\n", d.MachineName, d.ExpiresAt.Format(time.RFC3339))
+			continue
+		}
+
+		if err := d.Remove(); err != nil {
+			failed = append(failed, fmt.Sprintf("%v: %v", d.MachineName, strings.TrimPrefix(err.Error(), tag)))
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(*storePath, "machines", d.MachineName)); err != nil {
+			failed = append(failed, fmt.Sprintf("%v: %v", d.MachineName, err))
+			continue
+		}
+		fmt.Printf("Removed %v, expired at %v\n", d.MachineName, d.ExpiresAt.Format(time.RFC3339))
+	}
+
+	if reaped == 0 {
+		fmt.Printf("No expired machines in %v\n", *storePath)
+	}
+	if len(failed) > 0 {
+		return errors.New(tag + "Failed to remove expired machines:\n  - " + strings.Join(failed, "\n  - "))
+	}
+	return nil
+}
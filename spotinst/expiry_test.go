@@ -0,0 +1,81 @@
+package spotinst
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+)
+
+// createExpired creates a machine that expired an hour ago and saves it to
+// the store.
+func (e *testEnv) createExpired(t *testing.T, name string) *Driver {
+	d := e.create(t, name)
+	d.ExpiresAt = time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	e.save(t, d)
+	return d
+}
+
+func (e *testEnv) saved(name string) bool {
+	_, err := os.Stat(filepath.Join(e.store, "machines", name, "config.json"))
+	return err == nil
+}
+
+func TestReapRemovesExpiredMachines(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	expired := env.createExpired(t, "expired")
+	env.create(t, "kept")
+
+	if err := reapCommand([]string{"--storage-path", env.store}); err != nil {
+		t.Fatal(err)
+	}
+	g := env.group(t)
+	if len(g.Detached) != 1 || g.Detached[0] != *expired.InstanceId {
+		t.Errorf("detached %v, want [%v]", g.Detached, *expired.InstanceId)
+	}
+	if env.saved("expired") {
+		t.Error("expired machine is still in the store")
+	}
+	if !env.saved("kept") {
+		t.Error("machine that has not expired was removed from the store")
+	}
+}
+
+func TestReapDryRun(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	env.createExpired(t, "expired")
+
+	if err := reapCommand([]string{"--storage-path", env.store, "--dry-run"}); err != nil {
+		t.Fatal(err)
+	}
+	if g := env.group(t); len(g.Detached) != 0 || len(g.Instances) != 1 {
+		t.Errorf("dry run detached %v, leaving %v instances", g.Detached, len(g.Instances))
+	}
+	if !env.saved("expired") {
+		t.Error("dry run removed the machine from the store")
+	}
+}
+
+func TestReapKeepsMachineWhenRemoveFails(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	env.createExpired(t, "expired")
+	env.srv.Fail(spotinsttest.OpDetach, http.StatusBadRequest, 10)
+
+	err := reapCommand([]string{"--storage-path", env.store})
+	if err == nil || !strings.Contains(err.Error(), "- expired: ") {
+		t.Fatalf("got %v, want an error naming the machine", err)
+	}
+	if !env.saved("expired") {
+		t.Error("machine whose remove failed was removed from the store")
+	}
+}
@@ -0,0 +1,38 @@
+package spotinst
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	lockRetryInterval = 50 * time.Millisecond
+	lockStaleAfter    = time.Minute
+)
+
+// lockFile takes an exclusive lock on path by creating it, and returns the
+// function releasing it by removing it. It waits while another process holds
+// the lock, and breaks locks left behind by processes that died.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(lockStaleAfter)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > lockStaleAfter {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %v", path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
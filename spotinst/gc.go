@@ -0,0 +1,262 @@
+package spotinst
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+)
+
+const (
+	storagePathEnvVar = "MACHINE_STORAGE_PATH"
+	defaultGCMinAge   = time.Hour
+)
+
+// gcGroup is an Elastigroup referenced by the machines of a store, with what
+// the garbage collection found in it.
+type gcGroup struct {
+	// driver is the first machine of the group, whose settings and
+	// credentials are used to reach it.
+	driver   *Driver
+	machines []*Driver
+
+	orphans []*instance
+	// records are the instance records of the store by instance ID.
+	records map[string]map[string]string
+}
+
+// gcCommand lists the instances of the groups referenced by a docker-machine
+// store that no machine of the store owns, and the machines of the store whose
+// instance is gone. With --apply it detaches the orphaned instances.
+func gcCommand(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	storePath := fs.String("storage-path", defaultStorePath(), "docker-machine store to compare the groups against")
+	apply := fs.Bool("apply", false, "detach the orphaned instances, decrementing the capacity of their groups")
+	minAge := fs.Duration("min-age", defaultGCMinAge, "leave alone instances younger than this, whose create may still be running")
+	anyCreator := fs.Bool("any-creator", false, "also collect the instances created by other users and hosts, whose machines are in other stores")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf(tag+"Unexpected arguments %v", strings.Join(fs.Args(), " "))
+	}
+
+	machines, err := loadMachines(*storePath)
+	if err != nil {
+		return err
+	}
+	if len(machines) == 0 {
+		fmt.Printf("No spotinst machines in %v\n", *storePath)
+		return nil
+	}
+
+	createdBy := creator()
+	if *anyCreator {
+		createdBy = ""
+	}
+	groups, lost, failed := collectGarbage(machines, *minAge, createdBy)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Instances without a machine:")
+	fmt.Fprintln(w, "  GROUP\tINSTANCE\tSTATUS\tMACHINE ID\tNAME\tCREATED")
+	orphans := 0
+	for _, g := range groups {
+		for _, inst := range g.orphans {
+			fmt.Fprintf(w, "  %v\t%v\t%v\t%v\t%v\t%v\n", g.driver.SpotinstElastiGroupID, inst.ID, inst.Status,
+				g.records[inst.ID][machineIdTagKey], g.records[inst.ID][nameTagKey], g.createdAt(inst).Format(time.RFC3339))
+			orphans++
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Machines without an instance:")
+	fmt.Fprintln(w, "  MACHINE\tGROUP\tINSTANCE")
+	for _, d := range lost {
+		fmt.Fprintf(w, "  %v\t%v\t%v\n", d.MachineName, d.SpotinstElastiGroupID, spotinst.StringValue(d.InstanceId))
+	}
+	w.Flush()
+
+	if len(lost) > 0 {
+		fmt.Println("\nRemove machines without an instance with docker-machine rm -f.")
+	}
+	if orphans > 0 && !*apply {
+		fmt.Println("\nRun again with --apply to detach the instances without a machine.")
+	}
+
+	for _, g := range groups {
+		if !*apply {
+			break
+		}
+		if err := g.detachOrphans(); err != nil {
+			failed = append(failed, strings.TrimPrefix(err.Error(), tag))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(tag + "Garbage collection incomplete:\n  - " + strings.Join(failed, "\n  - "))
+	}
+	return nil
+}
+
+// defaultStorePath returns the store docker-machine uses by default.
+func defaultStorePath() string {
+	if path := os.Getenv(storagePathEnvVar); path != "" {
+		return path
+	}
+	return filepath.Join(mcnutils.GetHomeDir(), ".docker", "machine")
+}
+
+// loadMachines returns the drivers of the spotinst machines of the store, as
+// docker-machine loads them from their config.json.
+func loadMachines(storePath string) ([]*Driver, error) {
+	dirs, err := ioutil.ReadDir(filepath.Join(storePath, "machines"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(tag+"Failed to read the machine store: %v", err)
+	}
+
+	var machines []*Driver
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(storePath, "machines", dir.Name(), "config.json"))
+		if err != nil {
+			stdLog(DEBUG, "Skipping machine %v: %v", dir.Name(), err)
+			continue
+		}
+
+		var host struct {
+			Name       string
+			DriverName string
+			Driver     json.RawMessage
+		}
+		if err := json.Unmarshal(b, &host); err != nil {
+			return nil, fmt.Errorf(tag+"Failed to read the config of machine %v: %v", dir.Name(), err)
+		}
+		if host.DriverName != driverName {
+			continue
+		}
+
+		d := NewDriver(host.Name, storePath)
+		if err := json.Unmarshal(host.Driver, d); err != nil {
+			return nil, fmt.Errorf(tag+"Failed to read the config of machine %v: %v", dir.Name(), err)
+		}
+		d.StorePath = storePath
+		if _, err := d.restoreCreateProgress(); err != nil {
+			return nil, err
+		}
+		machines = append(machines, d)
+	}
+	return machines, nil
+}
+
+// collectGarbage compares the machines with the instances of their groups. It
+// returns the groups with their orphaned instances, i.e. recorded with the ID
+// of a machine the store does not have, at least minAge old and, unless
+// createdBy is empty, created by createdBy, and the machines whose instance
+// left the group. Dedicated groups and stateful nodes belong to
+// a single machine and are skipped. Groups that cannot be read are skipped and
+// reported as failed.
+func collectGarbage(machines []*Driver, minAge time.Duration, createdBy string) (groups []*gcGroup, lost []*Driver, failed []string) {
+	ids := make(map[string]bool, len(machines))
+	byKey := make(map[string]*gcGroup)
+	var keys []string
+	for _, d := range machines {
+		ids[d.Id] = true
+		if d.SpotinstBackend == BackendStatefulNode || d.SpotinstGroupTemplate != "" || d.SpotinstElastiGroupID == "" {
+			continue
+		}
+		key := d.groupKey(d.SpotinstElastiGroupID)
+		if byKey[key] == nil {
+			byKey[key] = &gcGroup{driver: d}
+			keys = append(keys, key)
+		}
+		byKey[key].machines = append(byKey[key].machines, d)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		g := byKey[key]
+		instances, err := g.driver.groupStatus()
+		if err == nil {
+			g.records, err = g.driver.instanceRecords(g.driver.SpotinstElastiGroupID)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("group %v: %v", g.driver.SpotinstElastiGroupID, strings.TrimPrefix(err.Error(), tag)))
+			continue
+		}
+
+		live := make(map[string]bool)
+		for _, inst := range instances {
+			if inst.Gone || inst.ID == "" {
+				continue
+			}
+			live[inst.ID] = true
+			owner := g.records[inst.ID][machineIdTagKey]
+			if owner == "" {
+				continue
+			}
+			live[owner] = true
+			if ids[owner] || time.Since(g.createdAt(inst)) < minAge {
+				continue
+			}
+			if createdBy == "" || g.records[inst.ID][creatorTagKey] == createdBy {
+				g.orphans = append(g.orphans, inst)
+			}
+		}
+
+		for _, d := range g.machines {
+			if !live[spotinst.StringValue(d.InstanceId)] && !live[d.Id] {
+				lost = append(lost, d)
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups, lost, failed
+}
+
+// createdAt returns when the instance was first recorded for its machine,
+// which is later than its launch for a warm pool instance, or else when it
+// was launched.
+func (g *gcGroup) createdAt(inst *instance) time.Time {
+	if created, err := time.Parse(time.RFC3339, g.records[inst.ID][createdAtTagKey]); err == nil {
+		return created
+	}
+	return inst.CreatedAt
+}
+
+// detachOrphans detaches the orphaned instances of the group, terminating them
+// and decrementing its capacity.
+func (g *gcGroup) detachOrphans() error {
+	if len(g.orphans) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(g.orphans))
+	for i, inst := range g.orphans {
+		ids[i] = inst.ID
+	}
+
+	p, err := g.driver.provider()
+	if err != nil {
+		return err
+	}
+	if err := p.Detach(context.Background(), g.driver.SpotinstElastiGroupID, ids); err != nil {
+		return fmt.Errorf(tag+"Failed to detach %v from group %v: %v", strings.Join(ids, ", "), g.driver.SpotinstElastiGroupID, err)
+	}
+
+	fmt.Printf("Detached %v from group %v\n", strings.Join(ids, ", "), g.driver.SpotinstElastiGroupID)
+	return nil
+}
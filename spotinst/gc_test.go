@@ -0,0 +1,167 @@
+package spotinst
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/state"
+)
+
+// save saves the machine to the store as docker-machine does, so that
+// loadMachines finds it.
+func (e *testEnv) save(t *testing.T, d *Driver) {
+	dir := filepath.Join(e.store, "machines", d.MachineName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(map[string]interface{}{"Name": d.MachineName, "DriverName": driverName, "Driver": d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// create creates a machine and saves it to the store.
+func (e *testEnv) create(t *testing.T, name string) *Driver {
+	d := e.driver(name)
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	e.save(t, d)
+	return d
+}
+
+// setRecord changes the record of an instance in the store.
+func (e *testEnv) setRecord(t *testing.T, instanceID string, tags map[string]string) {
+	err := e.driver("").updateInstanceRecords(testGroupID, func(records map[string]map[string]string) error {
+		setRecord(records, instanceID, tags)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (e *testEnv) collectGarbage(t *testing.T, minAge time.Duration, createdBy string) (orphans []string, lost []string) {
+	machines, err := loadMachines(e.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, lostMachines, failed := collectGarbage(machines, minAge, createdBy)
+	if len(failed) > 0 {
+		t.Fatalf("garbage collection failed: %v", failed)
+	}
+	for _, g := range groups {
+		for _, inst := range g.orphans {
+			orphans = append(orphans, inst.ID)
+		}
+	}
+	for _, d := range lostMachines {
+		lost = append(lost, d.MachineName)
+	}
+	return orphans, lost
+}
+
+func TestGCFindsOrphansBothWays(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	env.create(t, "kept")
+	lost := env.create(t, "lost")
+	if err := env.srv.Drop(testGroupID, *lost.InstanceId); err != nil {
+		t.Fatal(err)
+	}
+	// A machine whose directory was deleted.
+	deleted := env.driver("deleted")
+	if err := deleted.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, lostNames := env.collectGarbage(t, 0, "")
+	if len(orphans) != 1 || orphans[0] != *deleted.InstanceId {
+		t.Errorf("orphans are %v, want [%v]", orphans, *deleted.InstanceId)
+	}
+	if len(lostNames) != 1 || lostNames[0] != "lost" {
+		t.Errorf("machines without an instance are %v, want [lost]", lostNames)
+	}
+}
+
+func TestGCMinAge(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	env.create(t, "kept")
+	deleted := env.driver("deleted")
+	if err := deleted.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	if orphans, _ := env.collectGarbage(t, time.Hour, ""); len(orphans) != 0 {
+		t.Fatalf("orphans are %v, want none younger than an hour", orphans)
+	}
+
+	created := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	env.setRecord(t, *deleted.InstanceId, map[string]string{createdAtTagKey: created})
+	if orphans, _ := env.collectGarbage(t, time.Hour, ""); len(orphans) != 1 || orphans[0] != *deleted.InstanceId {
+		t.Fatalf("orphans are %v, want [%v] created two hours ago", orphans, *deleted.InstanceId)
+	}
+}
+
+func TestGCCreatorFilter(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	env.create(t, "kept")
+	mine := env.driver("mine")
+	if err := mine.Create(); err != nil {
+		t.Fatal(err)
+	}
+	theirs := env.driver("theirs")
+	if err := theirs.Create(); err != nil {
+		t.Fatal(err)
+	}
+	env.setRecord(t, *theirs.InstanceId, map[string]string{creatorTagKey: "someone@elsewhere"})
+
+	if orphans, _ := env.collectGarbage(t, 0, creator()); len(orphans) != 1 || orphans[0] != *mine.InstanceId {
+		t.Errorf("orphans created here are %v, want [%v]", orphans, *mine.InstanceId)
+	}
+	if orphans, _ := env.collectGarbage(t, 0, ""); len(orphans) != 2 {
+		t.Errorf("orphans of any creator are %v, want 2", orphans)
+	}
+}
+
+func TestGCApply(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	kept := env.create(t, "kept")
+	deleted := env.driver("deleted")
+	if err := deleted.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"--storage-path", env.store, "--min-age", "0"}
+	if err := gcCommand(args); err != nil {
+		t.Fatal(err)
+	}
+	if g := env.group(t); len(g.Detached) != 0 {
+		t.Fatalf("gc without --apply detached %v", g.Detached)
+	}
+
+	if err := gcCommand(append(args, "--apply")); err != nil {
+		t.Fatal(err)
+	}
+	g := env.group(t)
+	if len(g.Detached) != 1 || g.Detached[0] != *deleted.InstanceId {
+		t.Fatalf("detached %v, want [%v]", g.Detached, *deleted.InstanceId)
+	}
+	if s, err := env.reload(t, kept).GetState(); err != nil || s != state.Running {
+		t.Errorf("machine kept got state %v, %v, want Running", s, err)
+	}
+}
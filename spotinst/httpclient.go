@@ -0,0 +1,92 @@
+package spotinst
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+)
+
+const defaultRequestTimeout = 60 // seconds
+
+// parseEndpointURL parses the URL of the API or of the proxy.
+func parseEndpointURL(name, rawurl string) (*url.URL, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf(tag+"Invalid %v URL %q: %v", name, rawurl, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf(tag+"Invalid %v URL %q, it needs a scheme and a host", name, rawurl)
+	}
+	return u, nil
+}
+
+// httpClient returns the HTTP client for the Spotinst API, going through the
+// proxy and trusting the CA bundle of the machine, if any. Without a proxy the
+// HTTPS_PROXY and NO_PROXY environment variables apply, as by default.
+//
+// The request timeout bounds the wait for the response of each attempt, not
+// the whole call, so that retries and their Retry-After waits do not eat into
+// it.
+func (d *Driver) httpClient() (*http.Client, error) {
+	transport := spotinst.DefaultTransport()
+	transport.ResponseHeaderTimeout = time.Duration(d.RequestTimeout) * time.Second
+
+	if d.SpotinstHTTPProxy != "" {
+		proxy, err := parseEndpointURL("proxy", d.SpotinstHTTPProxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if d.SpotinstCABundle != "" {
+		pem, err := ioutil.ReadFile(d.SpotinstCABundle)
+		if err != nil {
+			return nil, fmt.Errorf(tag+"Failed to read the CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf(tag+"No PEM certificates found in the CA bundle %v", d.SpotinstCABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// configureEndpoint points config at the API URL of the machine, through its
+// HTTP client.
+func (d *Driver) configureEndpoint(config *spotinst.Config) error {
+	if d.SpotinstAPIURL != "" {
+		if _, err := parseEndpointURL("API", d.SpotinstAPIURL); err != nil {
+			return err
+		}
+		config.WithBaseURL(d.SpotinstAPIURL)
+	}
+
+	client, err := d.httpClient()
+	if err != nil {
+		return err
+	}
+	config.WithHTTPClient(client)
+	return nil
+}
+
+// errorTransport fails every request, so that an unusable endpoint setting is
+// reported by the API calls rather than bypassed.
+type errorTransport struct {
+	err error
+}
+
+func (t errorTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
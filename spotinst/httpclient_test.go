@@ -0,0 +1,28 @@
+package spotinst
+
+import "testing"
+
+func TestClientBuiltOncePerDriver(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	builds := 0
+	d.clientFactory = func() Client {
+		builds++
+		return d.BuildClient()
+	}
+
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetState(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if builds != 1 {
+		t.Errorf("client was built %v times, want 1", builds)
+	}
+}
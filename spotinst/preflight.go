@@ -0,0 +1,113 @@
+package spotinst
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/docker/machine/libmachine/ssh"
+)
+
+// preflight collects the problems PreCreateCheck finds, so that they are all
+// reported at once instead of one per attempt.
+type preflight []string
+
+func (p *preflight) fail(format string, args ...interface{}) {
+	msg := strings.Replace(fmt.Sprintf(format, args...), tag, "", -1)
+	*p = append(*p, strings.TrimSpace(msg))
+}
+
+func (p *preflight) add(err error) {
+	p.fail("%v", err)
+}
+
+func (p preflight) err() error {
+	switch len(p) {
+	case 0:
+		return nil
+	case 1:
+		return errors.New(tag + p[0])
+	default:
+		return errors.New(tag + "Preflight checks failed:\n  - " + strings.Join(p, "\n  - "))
+	}
+}
+
+// checkAPIError adds err, telling rejected credentials apart from other
+// failures of what was attempted.
+func (p *preflight) checkAPIError(err error, attempted string) {
+	switch statusCode(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		p.fail("Spotinst credentials were rejected: %v", err)
+	default:
+		p.fail("Failed to %v: %v", attempted, err)
+	}
+}
+
+// checkSSHKey checks that the given SSH key exists and can be used by
+// libmachine, or that one can be generated for the machine.
+func (d *Driver) checkSSHKey(p *preflight) {
+	// Without a key, one is generated and injected into the user data of the
+	// machine's own group or stateful node, which a shared group lacks.
+	if d.SSHKeyPath == "" {
+		if d.SpotinstGroupTemplate == "" {
+			p.fail("Server SSH Key not provided, it can only be generated with --spotinst-group-template")
+		}
+		return
+	}
+
+	if _, err := os.Stat(d.SSHKeyPath); err != nil {
+		p.fail("Server SSH Key not found: %v", err)
+		return
+	}
+	if _, err := ssh.NewNativeConfig(d.SSHUser, &ssh.Auth{Keys: []string{d.SSHKeyPath}}); err != nil {
+		p.fail("Server SSH Key %v cannot be used: %v", d.SSHKeyPath, err)
+	}
+}
+
+// checkGroup checks the credentials and the Elastigroup against the API:
+// that the group exists, resolving it by name and tags if needed, and that it
+// has room for one more instance. The rules of its security groups cannot be
+// checked, as the Spotinst API has no call to read them.
+func (d *Driver) checkGroup(p *preflight) {
+	prov, err := d.provider()
+	if err != nil {
+		p.add(err)
+		return
+	}
+	ctx := context.Background()
+
+	switch {
+	case d.SpotinstBackend == BackendStatefulNode || d.SpotinstGroupTemplate != "":
+		// Listing the groups is the cheapest call that checks the credentials
+		// without a group to read.
+		if _, err := prov.List(ctx); err != nil {
+			p.checkAPIError(err, "list Elastigroups")
+		}
+	case d.SpotinstElastiGroupID == "":
+		if !d.hasGroupSelector() {
+			return
+		}
+		groups, err := prov.List(ctx)
+		if err != nil {
+			p.checkAPIError(err, "list Elastigroups")
+			return
+		}
+		if err := d.selectElastiGroup(groups); err != nil {
+			p.add(err)
+			return
+		}
+		fallthrough
+	default:
+		group, err := prov.Read(ctx, d.SpotinstElastiGroupID)
+		if err != nil {
+			p.checkAPIError(err, "read Elastigroup "+d.SpotinstElastiGroupID)
+			return
+		}
+		if group.Maximum > 0 && group.Target+scaleAdjustment > group.Maximum {
+			p.fail("Elastigroup %v is at its maximum capacity of %v instances, raise capacity.maximum to add one", d.SpotinstElastiGroupID, group.Maximum)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package spotinst
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+	"github.com/docker/machine/libmachine/ssh"
+)
+
+// preflightDriver returns a driver of the test group with a usable SSH key.
+func preflightDriver(t *testing.T, env *testEnv) *Driver {
+	key := filepath.Join(env.store, "id_rsa")
+	if err := ssh.GenerateSSHKey(key); err != nil {
+		t.Fatal(err)
+	}
+	d := env.driver("m1")
+	d.SSHKeyPath = key
+	return d
+}
+
+func TestPreCreateCheckPasses(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.UpdateGroup(testGroupID, func(g *spotinsttest.Group) { g.Maximum = 2 })
+
+	if err := preflightDriver(t, env).PreCreateCheck(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPreCreateCheckReportsEveryProblem(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.UpdateGroup(testGroupID, func(g *spotinsttest.Group) {
+		g.Target = 2
+		g.Maximum = 2
+	})
+
+	d := preflightDriver(t, env)
+	d.SSHKeyPath = filepath.Join(env.store, "missing")
+	err := d.PreCreateCheck()
+	if err == nil {
+		t.Fatal("preflight passed a full group and a missing SSH key")
+	}
+	for _, want := range []string{
+		"is at its maximum capacity of 2 instances",
+		"Server SSH Key not found",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("preflight error %q does not report %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package spotinst
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+)
+
+const createProgressFile = "spotinst-create.json"
+
+// createProgress records how far Create got, so that a Create interrupted
+// while waiting on Spotinst can be resumed, or cleaned up by Remove, instead
+// of leaking the capacity it added to the group.
+type createProgress struct {
+	Phase                 string `json:"phase"`
+	GroupID               string `json:"groupId"`
+	SpotInstanceRequestID string `json:"spotInstanceRequestId,omitempty"`
+	InstanceID            string `json:"instanceId,omitempty"`
+	StatefulNodeID        string `json:"statefulNodeId,omitempty"`
+}
+
+func (d *Driver) saveCreateProgress(phase string) error {
+	progress := createProgress{
+		Phase:                 phase,
+		GroupID:               d.SpotinstElastiGroupID,
+		SpotInstanceRequestID: d.SpotInstanceRequest,
+		InstanceID:            spotinst.StringValue(d.InstanceId),
+		StatefulNodeID:        spotinst.StringValue(d.StatefulNodeId),
+	}
+
+	b, err := json.MarshalIndent(progress, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	path := d.ResolveStorePath(createProgressFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf(tag+"Failed to save create progress: %v", err)
+	}
+	if err := writeFileAtomic(path, b); err != nil {
+		return fmt.Errorf(tag+"Failed to save create progress: %v", err)
+	}
+
+	stdLog(DEBUG, "Saved create progress: %v", phase)
+	return nil
+}
+
+// loadCreateProgress returns the saved progress, or nil if there is none.
+func (d *Driver) loadCreateProgress() (*createProgress, error) {
+	b, err := ioutil.ReadFile(d.ResolveStorePath(createProgressFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(tag+"Failed to read create progress: %v", err)
+	}
+
+	progress := new(createProgress)
+	if err := json.Unmarshal(b, progress); err != nil {
+		return nil, fmt.Errorf(tag+"Failed to read create progress: %v", err)
+	}
+
+	return progress, nil
+}
+
+// restoreCreateProgress loads the saved progress and fills in the driver
+// fields it knows about that are not set yet.
+func (d *Driver) restoreCreateProgress() (*createProgress, error) {
+	progress, err := d.loadCreateProgress()
+	if err != nil || progress == nil {
+		return progress, err
+	}
+
+	if d.SpotinstElastiGroupID != "" && progress.GroupID != d.SpotinstElastiGroupID {
+		stdLog(WARN, "Ignoring create progress of group %v", progress.GroupID)
+		return nil, nil
+	}
+
+	if d.SpotinstElastiGroupID == "" {
+		d.SpotinstElastiGroupID = progress.GroupID
+	}
+	if d.SpotInstanceRequest == "" {
+		d.SpotInstanceRequest = progress.SpotInstanceRequestID
+	}
+	if d.InstanceId == nil && progress.InstanceID != "" {
+		d.InstanceId = spotinst.String(progress.InstanceID)
+	}
+	if d.StatefulNodeId == nil && progress.StatefulNodeID != "" {
+		d.StatefulNodeId = spotinst.String(progress.StatefulNodeID)
+	}
+
+	return progress, nil
+}
+
+func (d *Driver) clearCreateProgress() error {
+	err := os.Remove(d.ResolveStorePath(createProgressFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf(tag+"Failed to clear create progress: %v", err)
+	}
+	return nil
+}
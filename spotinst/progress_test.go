@@ -0,0 +1,92 @@
+package spotinst
+
+import (
+	"os"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+)
+
+func TestCreateResumesInterruptedCreate(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.Script(testGroupID, spotinsttest.SpotRequest{Delay: 1})
+
+	// A create that was killed right after its scale up.
+	if err := env.driver("m1").scaleUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := env.driver("m1")
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.srv.Calls(spotinsttest.OpScaleUp); n != 1 {
+		t.Errorf("group was scaled up %v times, want 1", n)
+	}
+
+	g := env.group(t)
+	if len(g.Instances) != 1 || d.InstanceId == nil || *d.InstanceId != g.Instances[0].ID {
+		t.Fatalf("machine has instance %v, want the one of the interrupted create", d.InstanceId)
+	}
+	if _, err := os.Stat(d.ResolveStorePath(createProgressFile)); !os.IsNotExist(err) {
+		t.Errorf("create progress was not cleared: %v", err)
+	}
+}
+
+func TestRemoveAdoptsInstanceOfInterruptedCreate(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	if err := env.driver("m1").scaleUp(); err != nil {
+		t.Fatal(err)
+	}
+	// The spot request is fulfilled while nobody waits for it.
+	env.fulfill(t)
+	id := env.group(t).Instances[0].ID
+
+	if err := env.driver("m1").Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	g := env.group(t)
+	if g.Target != 0 || len(g.Instances) != 0 {
+		t.Fatalf("group has target %v and %v instances after remove, want 0 and 0", g.Target, len(g.Instances))
+	}
+	if len(g.Detached) != 1 || g.Detached[0] != id {
+		t.Errorf("detached %v, want [%v]", g.Detached, id)
+	}
+	if n := env.srv.Calls(spotinsttest.OpScaleDown); n != 0 {
+		t.Errorf("group was scaled down %v times, want the instance detached instead", n)
+	}
+}
+
+func TestRemoveDropsPendingSpotRequest(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.Script(testGroupID, spotinsttest.SpotRequest{Delay: 10})
+
+	// A create that was killed while its spot request was pending.
+	if err := env.driver("m1").scaleUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := env.driver("m1")
+	if err := d.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	g := env.group(t)
+	if g.Target != 0 || len(g.Instances) != 0 {
+		t.Fatalf("group has target %v and %v instances after remove, want 0 and 0", g.Target, len(g.Instances))
+	}
+	if n := env.srv.Calls(spotinsttest.OpScaleDown); n != 1 {
+		t.Errorf("group was scaled down %v times, want 1", n)
+	}
+	if len(g.Detached) != 0 {
+		t.Errorf("detached %v, want nothing", g.Detached)
+	}
+	if d.SpotInstanceRequest != "" {
+		t.Errorf("machine kept spot request %v", d.SpotInstanceRequest)
+	}
+}
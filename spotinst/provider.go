@@ -0,0 +1,558 @@
+package spotinst
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/spotinst/spotinst-sdk-go/service/elastigroup/providers/aws"
+	"github.com/spotinst/spotinst-sdk-go/service/elastigroup/providers/azure"
+	"github.com/spotinst/spotinst-sdk-go/service/elastigroup/providers/gcp"
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+)
+
+// launchedAfterPrefix marks the request IDs of providers whose scale up does
+// not report what it launched: the request resolves to the first instance
+// created after the newest instance of the group at the time of the scale up.
+const launchedAfterPrefix = "launched-after:"
+
+// instance is an instance of an Elastigroup, as reported by any provider.
+type instance struct {
+	// ID is empty while the instance is not launched yet.
+	ID string
+	// RequestID is the spot request of the instance, if any.
+	RequestID string
+	// Status is the status as named by the provider.
+	Status    string
+	State     state.State
+	Gone      bool
+	PrivateIP string
+	PublicIP  string
+	CreatedAt time.Time
+}
+
+// groupInfo is the configuration of an Elastigroup, as read by any provider.
+type groupInfo struct {
+	ID   string
+	Name string
+	// Tags are the instance tags, or labels on GCP, of the group.
+	Tags map[string]string
+
+	Target  int
+	Maximum int
+}
+
+// provider is the set of Elastigroup operations the driver needs, over each
+// cloud provider supported by Spotinst.
+type provider interface {
+	// ScaleUp adds an instance to the group. It returns the ID of the instance
+	// if it is known right away, otherwise the ID of a request that findRequest
+	// resolves to the instance once it is launched.
+	ScaleUp(ctx context.Context, groupID string) (instanceID, requestID string, err error)
+
+	ScaleDown(ctx context.Context, groupID string, adjustment int) error
+
+	Status(ctx context.Context, groupID string) ([]*instance, error)
+
+	// Detach detaches and terminates instances, decrementing the capacity.
+	Detach(ctx context.Context, groupID string, instanceIDs []string) error
+
+	// FindRequest returns the instance launched for requestID, nil while it is
+	// pending, or errSpotRequestNotFound if the request was cancelled.
+	FindRequest(instances []*instance, requestID string) (*instance, error)
+
+	// List returns the groups of the account.
+	List(ctx context.Context) ([]*groupInfo, error)
+
+	// Read returns the configuration of a group.
+	Read(ctx context.Context, groupID string) (*groupInfo, error)
+}
+
+func newProvider(name string, c Client) (provider, error) {
+	switch name {
+	case CloudProviderAWS, "":
+		return &awsProvider{c}, nil
+	case CloudProviderAzure:
+		return &azureProvider{c}, nil
+	case CloudProviderGCP:
+		return &gcpProvider{c}, nil
+	default:
+		return nil, fmt.Errorf(tag+"Unsupported cloud provider %q, must be one of %v, %v or %v",
+			name, CloudProviderAWS, CloudProviderAzure, CloudProviderGCP)
+	}
+}
+
+// provider returns the provider of the machine's Elastigroup.
+func (d *Driver) provider() (provider, error) {
+	p, err := newProvider(d.SpotinstCloudProvider, d.getClient())
+	if err != nil {
+		return nil, err
+	}
+	return statusCachingProvider{apiProvider{p}, d}, nil
+}
+
+// cloudProvider returns the cloud provider of the machine's Elastigroup.
+// Machines created before the provider could be chosen are on AWS.
+func (d *Driver) cloudProvider() string {
+	if d.SpotinstCloudProvider == "" {
+		return CloudProviderAWS
+	}
+	return d.SpotinstCloudProvider
+}
+
+// groupStatus returns the instances of the machine's Elastigroup.
+func (d *Driver) groupStatus() ([]*instance, error) {
+	p, err := d.provider()
+	if err != nil {
+		return nil, err
+	}
+	return p.Status(context.Background(), d.SpotinstElastiGroupID)
+}
+
+type awsProvider struct {
+	client Client
+}
+
+func (p *awsProvider) ScaleUp(ctx context.Context, groupID string) (string, string, error) {
+	var scaleType = "up"
+	var adjustment = scaleAdjustment
+	input := new(aws.ScaleGroupInput)
+	input.Adjustment = &adjustment
+	input.GroupID = spotinst.String(groupID)
+	input.ScaleType = &scaleType
+	output, err := p.client.CloudProviderAWS().Scale(ctx, input)
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(output.Items) == 0 {
+		return "", "", errors.New(tag + "No server created as result of scale")
+	}
+
+	scaleResultItem := output.Items[0]
+	if len(scaleResultItem.NewInstances) > 0 {
+		return spotinst.StringValue(scaleResultItem.NewInstances[0].InstanceID), "", nil
+	}
+	if len(scaleResultItem.NewSpotRequests) > 0 {
+		return "", spotinst.StringValue(scaleResultItem.NewSpotRequests[0].SpotInstanceRequestID), nil
+	}
+	return "", "", nil
+}
+
+func (p *awsProvider) ScaleDown(ctx context.Context, groupID string, adjustment int) error {
+	var scaleType = "down"
+	input := new(aws.ScaleGroupInput)
+	input.Adjustment = &adjustment
+	input.GroupID = spotinst.String(groupID)
+	input.ScaleType = &scaleType
+	_, err := p.client.CloudProviderAWS().Scale(ctx, input)
+	return err
+}
+
+func (p *awsProvider) Status(ctx context.Context, groupID string) ([]*instance, error) {
+	input := new(aws.StatusGroupInput)
+	input.GroupID = spotinst.String(groupID)
+	output, err := p.client.CloudProviderAWS().Status(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]*instance, 0, len(output.Instances))
+	for _, v := range output.Instances {
+		if v == nil {
+			continue
+		}
+		status := spotinst.StringValue(v.Status)
+		inst := &instance{
+			ID:        spotinst.StringValue(v.ID),
+			RequestID: spotinst.StringValue(v.SpotRequestID),
+			Status:    status,
+			State:     awsState(status),
+			Gone:      status == InstanceStateNameShuttingDown || status == InstanceStateNameTerminated,
+			PrivateIP: spotinst.StringValue(v.PrivateIP),
+			PublicIP:  spotinst.StringValue(v.PublicIP),
+		}
+		if v.CreatedAt != nil {
+			inst.CreatedAt = *v.CreatedAt
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+func (p *awsProvider) Detach(ctx context.Context, groupID string, instanceIDs []string) error {
+	input := new(aws.DetachGroupInput)
+	input.GroupID = spotinst.String(groupID)
+	input.InstanceIDs = instanceIDs
+	input.ShouldDecrementTargetCapacity = spotinst.Bool(true)
+	input.ShouldTerminateInstances = spotinst.Bool(true)
+	_, err := p.client.CloudProviderAWS().Detach(ctx, input)
+	return err
+}
+
+func (p *awsProvider) FindRequest(instances []*instance, requestID string) (*instance, error) {
+	for _, v := range instances {
+		if v.RequestID == requestID {
+			if v.ID == "" {
+				return nil, nil
+			}
+			return v, nil
+		}
+	}
+	return nil, errSpotRequestNotFound
+}
+
+func (p *awsProvider) List(ctx context.Context) ([]*groupInfo, error) {
+	output, err := p.client.CloudProviderAWS().List(ctx, new(aws.ListGroupsInput))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*groupInfo, 0, len(output.Groups))
+	for _, g := range output.Groups {
+		groups = append(groups, awsGroupInfo(g))
+	}
+	return groups, nil
+}
+
+func (p *awsProvider) Read(ctx context.Context, groupID string) (*groupInfo, error) {
+	output, err := p.client.CloudProviderAWS().Read(ctx, &aws.ReadGroupInput{GroupID: spotinst.String(groupID)})
+	if err != nil {
+		return nil, err
+	}
+	if output.Group == nil {
+		return nil, fmt.Errorf("Group %v not found", groupID)
+	}
+	return awsGroupInfo(output.Group), nil
+}
+
+func awsGroupInfo(g *aws.Group) *groupInfo {
+	info := &groupInfo{
+		ID:   spotinst.StringValue(g.ID),
+		Name: spotinst.StringValue(g.Name),
+		Tags: make(map[string]string),
+	}
+	if g.Capacity != nil {
+		info.Target = spotinst.IntValue(g.Capacity.Target)
+		info.Maximum = spotinst.IntValue(g.Capacity.Maximum)
+	}
+	if g.Compute != nil && g.Compute.LaunchSpecification != nil {
+		for _, t := range g.Compute.LaunchSpecification.Tags {
+			info.Tags[spotinst.StringValue(t.Key)] = spotinst.StringValue(t.Value)
+		}
+	}
+	return info
+}
+
+func awsState(status string) state.State {
+	switch status {
+	case InstanceStateNamePending:
+		return state.Starting
+	case InstanceStateNameRunning:
+		return state.Running
+	case InstanceStateNameStopping:
+		return state.Stopping
+	case InstanceStateNameShuttingDown:
+		return state.Stopping
+	case InstanceStateNameStopped:
+		return state.Stopped
+	case InstanceStateNameTerminated:
+		return state.Error
+	case InstanceStateNamePendingEvaluation:
+		return state.Starting
+	case InstanceStateNameFullfiled:
+		return state.Running
+	default:
+		log.Warnf(tag+"unrecognized instance state: %v", status)
+		return state.Error
+	}
+}
+
+type azureProvider struct {
+	client Client
+}
+
+func (p *azureProvider) ScaleUp(ctx context.Context, groupID string) (string, string, error) {
+	instances, err := p.Status(ctx, groupID)
+	if err != nil {
+		return "", "", err
+	}
+
+	var scaleType = "up"
+	var adjustment = scaleAdjustment
+	input := new(azure.ScaleGroupInput)
+	input.Adjustment = &adjustment
+	input.GroupID = spotinst.String(groupID)
+	input.ScaleType = &scaleType
+	if _, err := p.client.CloudProviderAzure().Scale(ctx, input); err != nil {
+		return "", "", err
+	}
+	return "", launchedAfter(instances), nil
+}
+
+func (p *azureProvider) ScaleDown(ctx context.Context, groupID string, adjustment int) error {
+	var scaleType = "down"
+	input := new(azure.ScaleGroupInput)
+	input.Adjustment = &adjustment
+	input.GroupID = spotinst.String(groupID)
+	input.ScaleType = &scaleType
+	_, err := p.client.CloudProviderAzure().Scale(ctx, input)
+	return err
+}
+
+func (p *azureProvider) Status(ctx context.Context, groupID string) ([]*instance, error) {
+	input := new(azure.StatusGroupInput)
+	input.GroupID = spotinst.String(groupID)
+	output, err := p.client.CloudProviderAzure().Status(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]*instance, 0, len(output.Nodes))
+	for _, v := range output.Nodes {
+		if v == nil {
+			continue
+		}
+		status := spotinst.StringValue(v.State)
+		inst := &instance{
+			ID:        spotinst.StringValue(v.ID),
+			Status:    status,
+			State:     azureState(status),
+			PrivateIP: spotinst.StringValue(v.IPAddress),
+		}
+		switch strings.ToLower(status) {
+		case AzureNodeStateDeallocating, AzureNodeStateDeallocated:
+			inst.Gone = true
+		}
+		if v.CreatedAt != nil {
+			inst.CreatedAt = *v.CreatedAt
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+func (p *azureProvider) Detach(ctx context.Context, groupID string, instanceIDs []string) error {
+	input := new(azure.DetachGroupInput)
+	input.GroupID = spotinst.String(groupID)
+	input.InstanceIDs = instanceIDs
+	input.ShouldDecrementTargetCapacity = spotinst.Bool(true)
+	input.ShouldTerminateInstances = spotinst.Bool(true)
+	_, err := p.client.CloudProviderAzure().Detach(ctx, input)
+	return err
+}
+
+func (p *azureProvider) FindRequest(instances []*instance, requestID string) (*instance, error) {
+	return findLaunchedAfter(instances, requestID)
+}
+
+func (p *azureProvider) List(ctx context.Context) ([]*groupInfo, error) {
+	output, err := p.client.CloudProviderAzure().List(ctx, new(azure.ListGroupsInput))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*groupInfo, 0, len(output.Groups))
+	for _, g := range output.Groups {
+		groups = append(groups, azureGroupInfo(g))
+	}
+	return groups, nil
+}
+
+func (p *azureProvider) Read(ctx context.Context, groupID string) (*groupInfo, error) {
+	output, err := p.client.CloudProviderAzure().Read(ctx, &azure.ReadGroupInput{GroupID: spotinst.String(groupID)})
+	if err != nil {
+		return nil, err
+	}
+	if output.Group == nil {
+		return nil, fmt.Errorf("Group %v not found", groupID)
+	}
+	return azureGroupInfo(output.Group), nil
+}
+
+func azureGroupInfo(g *azure.Group) *groupInfo {
+	info := &groupInfo{
+		ID:   spotinst.StringValue(g.ID),
+		Name: spotinst.StringValue(g.Name),
+		Tags: make(map[string]string),
+	}
+	if g.Capacity != nil {
+		info.Target = spotinst.IntValue(g.Capacity.Target)
+		info.Maximum = spotinst.IntValue(g.Capacity.Maximum)
+	}
+	return info
+}
+
+func azureState(status string) state.State {
+	switch strings.ToLower(status) {
+	case AzureNodeStateStarting:
+		return state.Starting
+	case AzureNodeStateRunning:
+		return state.Running
+	case AzureNodeStateStopping, AzureNodeStateDeallocating:
+		return state.Stopping
+	case AzureNodeStateStopped:
+		return state.Stopped
+	case AzureNodeStateDeallocated:
+		return state.Error
+	default:
+		log.Warnf(tag+"unrecognized node state: %v", status)
+		return state.Error
+	}
+}
+
+type gcpProvider struct {
+	client Client
+}
+
+func (p *gcpProvider) ScaleUp(ctx context.Context, groupID string) (string, string, error) {
+	instances, err := p.Status(ctx, groupID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := p.client.ScaleGCPGroup(ctx, groupID, "up", scaleAdjustment); err != nil {
+		return "", "", err
+	}
+	return "", launchedAfter(instances), nil
+}
+
+func (p *gcpProvider) ScaleDown(ctx context.Context, groupID string, adjustment int) error {
+	return p.client.ScaleGCPGroup(ctx, groupID, "down", adjustment)
+}
+
+func (p *gcpProvider) Status(ctx context.Context, groupID string) ([]*instance, error) {
+	input := new(gcp.StatusGroupInput)
+	input.GroupID = spotinst.String(groupID)
+	output, err := p.client.CloudProviderGCP().Status(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]*instance, 0, len(output.Instances))
+	for _, v := range output.Instances {
+		if v == nil {
+			continue
+		}
+		status := spotinst.StringValue(v.StatusName)
+		inst := &instance{
+			ID:        spotinst.StringValue(v.InstanceName),
+			Status:    status,
+			State:     gcpState(status),
+			Gone:      status == GCPInstanceStatusTerminated,
+			PrivateIP: spotinst.StringValue(v.PrivateIP),
+			PublicIP:  spotinst.StringValue(v.PublicIP),
+		}
+		if v.CreatedAt != nil {
+			inst.CreatedAt = *v.CreatedAt
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+func (p *gcpProvider) Detach(ctx context.Context, groupID string, instanceIDs []string) error {
+	return p.client.DetachGCPInstances(ctx, groupID, instanceIDs)
+}
+
+func (p *gcpProvider) FindRequest(instances []*instance, requestID string) (*instance, error) {
+	return findLaunchedAfter(instances, requestID)
+}
+
+func (p *gcpProvider) List(ctx context.Context) ([]*groupInfo, error) {
+	output, err := p.client.CloudProviderGCP().List(ctx, new(gcp.ListGroupsInput))
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*groupInfo, 0, len(output.Groups))
+	for _, g := range output.Groups {
+		groups = append(groups, gcpGroupInfo(g))
+	}
+	return groups, nil
+}
+
+func (p *gcpProvider) Read(ctx context.Context, groupID string) (*groupInfo, error) {
+	output, err := p.client.CloudProviderGCP().Read(ctx, &gcp.ReadGroupInput{GroupID: spotinst.String(groupID)})
+	if err != nil {
+		return nil, err
+	}
+	if output.Group == nil {
+		return nil, fmt.Errorf("Group %v not found", groupID)
+	}
+	return gcpGroupInfo(output.Group), nil
+}
+
+func gcpGroupInfo(g *gcp.Group) *groupInfo {
+	info := &groupInfo{
+		ID:   spotinst.StringValue(g.ID),
+		Name: spotinst.StringValue(g.Name),
+		Tags: make(map[string]string),
+	}
+	if g.Capacity != nil {
+		info.Target = spotinst.IntValue(g.Capacity.Target)
+		info.Maximum = spotinst.IntValue(g.Capacity.Maximum)
+	}
+	if g.Compute != nil && g.Compute.LaunchSpecification != nil {
+		for _, l := range g.Compute.LaunchSpecification.Labels {
+			info.Tags[spotinst.StringValue(l.Key)] = spotinst.StringValue(l.Value)
+		}
+	}
+	return info
+}
+
+func gcpState(status string) state.State {
+	switch status {
+	case GCPInstanceStatusProvisioning, GCPInstanceStatusStaging:
+		return state.Starting
+	case GCPInstanceStatusRunning:
+		return state.Running
+	case GCPInstanceStatusStopping, GCPInstanceStatusSuspending:
+		return state.Stopping
+	case GCPInstanceStatusStopped, GCPInstanceStatusSuspended:
+		return state.Stopped
+	case GCPInstanceStatusTerminated:
+		return state.Error
+	default:
+		log.Warnf(tag+"unrecognized instance status: %v", status)
+		return state.Error
+	}
+}
+
+// launchedAfter returns a request ID resolving to the first instance created
+// after the given ones. It relies on the creation times reported by Spotinst
+// only, so the local clock does not matter.
+func launchedAfter(instances []*instance) string {
+	var newest time.Time
+	for _, v := range instances {
+		if v.CreatedAt.After(newest) {
+			newest = v.CreatedAt
+		}
+	}
+	return launchedAfterPrefix + newest.UTC().Format(time.RFC3339Nano)
+}
+
+func findLaunchedAfter(instances []*instance, requestID string) (*instance, error) {
+	if !strings.HasPrefix(requestID, launchedAfterPrefix) {
+		return nil, errSpotRequestNotFound
+	}
+	after, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(requestID, launchedAfterPrefix))
+	if err != nil {
+		return nil, fmt.Errorf(tag+"Invalid request %v: %v", requestID, err)
+	}
+
+	var found *instance
+	for _, v := range instances {
+		if v.ID == "" || !v.CreatedAt.After(after) {
+			continue
+		}
+		if found == nil || v.CreatedAt.Before(found.CreatedAt) {
+			found = v
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,44 @@
+package spotinst
+
+import (
+	"testing"
+
+	"github.com/docker/machine/libmachine/state"
+)
+
+func TestCreateAndRemoveOnEachProvider(t *testing.T) {
+	for _, provider := range []string{CloudProviderAzure, CloudProviderGCP} {
+		t.Run(provider, func(t *testing.T) {
+			env := newTestEnv(t)
+			defer env.Close()
+
+			d := env.driver("m1")
+			d.SpotinstCloudProvider = provider
+			if err := d.Create(); err != nil {
+				t.Fatal(err)
+			}
+
+			g := env.group(t)
+			if g.Target != 1 || len(g.Instances) != 1 {
+				t.Fatalf("group has target %v and %v instances, want 1 and 1", g.Target, len(g.Instances))
+			}
+			id := g.Instances[0].ID
+			if d.InstanceId == nil || *d.InstanceId != id {
+				t.Fatalf("machine has instance %v, want %v", d.InstanceId, id)
+			}
+
+			loaded := env.reload(t, d)
+			if s, err := loaded.GetState(); err != nil || s != state.Running {
+				t.Errorf("got state %v, %v, want Running", s, err)
+			}
+			if err := loaded.Remove(); err != nil {
+				t.Fatal(err)
+			}
+
+			g = env.group(t)
+			if g.Target != 0 || len(g.Instances) != 0 {
+				t.Fatalf("group has target %v and %v instances after remove, want 0 and 0", g.Target, len(g.Instances))
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package spotinst
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const recordsSuffix = ".instances.json"
+
+// instanceRecords returns the tags the machines of the store recorded for the
+// instances of the group, by instance ID.
+//
+// Spotinst has no call to tag a single instance of a group: instances get the
+// tags of the launch specification of their group. So the machines of a
+// shared group record which instance they own, and the other machine tags, in
+// a file of the store. Nothing outside the store sees these records.
+func (d *Driver) instanceRecords(groupID string) (map[string]map[string]string, error) {
+	records := make(map[string]map[string]string)
+	path := d.groupCachePath(groupID, recordsSuffix)
+	if path == "" {
+		return records, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(tag+"Failed to read the instance records: %v", err)
+	}
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf(tag+"Corrupt instance records %v, remove it if no other create is running: %v", path, err)
+	}
+	return records, nil
+}
+
+// updateInstanceRecords changes the records of the instances of the group
+// under the lock of the store, so that concurrent updates of its machines
+// take turns. The records are saved unless update fails.
+func (d *Driver) updateInstanceRecords(groupID string, update func(records map[string]map[string]string) error) error {
+	path := d.groupCachePath(groupID, recordsSuffix)
+	if path == "" {
+		return errors.New(tag + "Machine has no store to record its instance in")
+	}
+
+	unlock, err := lockStoreFile(path)
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to lock the instance records: %v", err)
+	}
+	defer unlock()
+
+	records, err := d.instanceRecords(groupID)
+	if err != nil {
+		return err
+	}
+	if err := update(records); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, b); err != nil {
+		return fmt.Errorf(tag+"Failed to save the instance records: %v", err)
+	}
+	return nil
+}
+
+// setRecord merges tags into the record of an instance. Empty values remove
+// their tag, and a record left without tags is dropped.
+func setRecord(records map[string]map[string]string, instanceID string, tags map[string]string) {
+	record := records[instanceID]
+	if record == nil {
+		record = make(map[string]string, len(tags))
+	}
+	for k, v := range tags {
+		if v == "" {
+			delete(record, k)
+		} else {
+			record[k] = v
+		}
+	}
+	if len(record) == 0 {
+		delete(records, instanceID)
+		return
+	}
+	records[instanceID] = record
+}
+
+// pruneRecords drops the records of the instances no longer live in the
+// group.
+func pruneRecords(records map[string]map[string]string, instances []*instance) {
+	live := make(map[string]bool, len(instances))
+	for _, v := range instances {
+		if !v.Gone {
+			live[v.ID] = true
+		}
+	}
+	for id := range records {
+		if !live[id] {
+			delete(records, id)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package spotinst
+
+import "testing"
+
+func TestRecordInstanceKeepsCreationTime(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	id := *d.InstanceId
+	if env.records(t)[id][createdAtTagKey] == "" {
+		t.Fatalf("instance %v was recorded without a creation time", id)
+	}
+
+	const created = "2020-01-02T03:04:05Z"
+	err := d.updateInstanceRecords(testGroupID, func(records map[string]map[string]string) error {
+		records[id][createdAtTagKey] = created
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.recordInstance(); err != nil {
+		t.Fatal(err)
+	}
+	record := env.records(t)[id]
+	if record[createdAtTagKey] != created {
+		t.Errorf("recording the instance again changed its creation time to %v, want %v", record[createdAtTagKey], created)
+	}
+	if record[machineIdTagKey] != d.Id {
+		t.Errorf("instance is recorded for machine %q, want %q", record[machineIdTagKey], d.Id)
+	}
+}
@@ -0,0 +1,133 @@
+package spotinst
+
+import (
+	"strings"
+
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+)
+
+// currentInstance returns the status of the machine's instance. When Spotinst
+// has replaced an interrupted spot instance, it switches the driver over to
+// the replacement first. Only the driver is changed, nothing is recorded.
+func (d *Driver) currentInstance() (*instance, error) {
+	inst, err := d.getInstanceStatus()
+	if err == nil && !inst.Gone {
+		return inst, nil
+	}
+	if err != nil && !isInstanceNotFound(err) {
+		return nil, err
+	}
+
+	replacement, findErr := d.findReplacement()
+	if findErr != nil {
+		return nil, findErr
+	}
+	if replacement == nil {
+		if err != nil {
+			return nil, err
+		}
+		return inst, nil
+	}
+
+	stdLog(INFO, "Instance %v was replaced by %v", *d.InstanceId, replacement.ID)
+	d.InstanceId = spotinst.String(replacement.ID)
+	d.PrivateIpAddress = nil
+	d.PublicIpAddress = nil
+	if replacement.PrivateIP != "" {
+		d.PrivateIpAddress = spotinst.String(replacement.PrivateIP)
+	}
+	if replacement.PublicIP != "" {
+		d.PublicIpAddress = spotinst.String(replacement.PublicIP)
+	}
+	return replacement, nil
+}
+
+// findReplacement looks for another live instance of the group that belongs to
+// the machine, through its stateful instance or the records of the store. It
+// returns nil if there is none.
+func (d *Driver) findReplacement() (*instance, error) {
+	if d.InstanceId == nil || d.cloudProvider() != CloudProviderAWS {
+		return nil, nil
+	}
+
+	if d.StatefulInstanceId != nil {
+		statefulInstance, err := d.getStatefulInstance()
+		if err != nil {
+			return nil, err
+		}
+		replacementID := spotinst.StringValue(statefulInstance.InstanceID)
+		if replacementID == "" || replacementID == *d.InstanceId {
+			return nil, nil
+		}
+
+		instances, err := d.groupStatus()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range instances {
+			if v.ID == replacementID && !v.Gone {
+				return v, nil
+			}
+		}
+		return nil, nil
+	}
+
+	instances, err := d.groupStatus()
+	if err != nil {
+		return nil, err
+	}
+	records, err := d.instanceRecords(d.SpotinstElastiGroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range instances {
+		if v.ID != *d.InstanceId && !v.Gone && records[v.ID][machineIdTagKey] == d.Id {
+			return v, nil
+		}
+	}
+
+	return d.unrecordedReplacement(instances, records), nil
+}
+
+// unrecordedReplacement finds the replacement of the machine's instance, which
+// the store has no record of. The replacement is taken to be the one live
+// instance that neither a machine nor the warm pool recorded, launched after
+// the old instance. That is only known while the group still lists the old
+// instance as terminated: once it left the group, nil is returned, as it is
+// when several instances could be the replacement.
+func (d *Driver) unrecordedReplacement(instances []*instance, records map[string]map[string]string) *instance {
+	var old *instance
+	for _, v := range instances {
+		if v.ID == *d.InstanceId {
+			old = v
+		}
+	}
+	if old == nil || !old.Gone {
+		return nil
+	}
+
+	var candidates []*instance
+	var ids []string
+	for _, v := range instances {
+		if v.ID == "" || v.ID == *d.InstanceId || v.Gone || !v.CreatedAt.After(old.CreatedAt) {
+			continue
+		}
+		if r := records[v.ID]; r[machineIdTagKey] != "" || r[poolTagKey] != "" {
+			continue
+		}
+		candidates = append(candidates, v)
+		ids = append(ids, v.ID)
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil
+	case 1:
+		stdLog(INFO, "Instance %v is the only unrecorded instance of group %v, taking it as the replacement of %v", ids[0], d.SpotinstElastiGroupID, *d.InstanceId)
+		return candidates[0]
+	default:
+		stdLog(WARN, "Cannot tell which of the unrecorded instances %v of group %v replaced %v", strings.Join(ids, ", "), d.SpotinstElastiGroupID, *d.InstanceId)
+		return nil
+	}
+}
@@ -0,0 +1,102 @@
+package spotinst
+
+import (
+	"testing"
+
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+)
+
+func TestGetStateDoesNotRecordReplacement(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	replacementID, err := env.srv.Replace(testGroupID, *d.InstanceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := env.reload(t, d)
+	if _, err := loaded.GetState(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.InstanceId == nil || *loaded.InstanceId != replacementID {
+		t.Fatalf("machine has instance %v, want the replacement %v", loaded.InstanceId, replacementID)
+	}
+	if owner := env.records(t)[replacementID][machineIdTagKey]; owner != "" {
+		t.Errorf("reading the state recorded the replacement for machine %q", owner)
+	}
+}
+
+func TestGetStateDoesNotGuessAmongUnrecordedInstances(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	oldID := *d.InstanceId
+	if _, err := env.srv.Replace(testGroupID, oldID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another create launches an instance it has not recorded yet.
+	other := env.driver("other")
+	if err := other.scaleUp(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.groupStatus(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := env.reload(t, d)
+	loaded.GetState()
+	if loaded.InstanceId == nil || *loaded.InstanceId != oldID {
+		t.Fatalf("machine switched to instance %v with two unrecorded candidates", loaded.InstanceId)
+	}
+	for _, inst := range env.group(t).Instances {
+		if owner := env.records(t)[inst.ID][machineIdTagKey]; owner != "" && inst.ID != oldID {
+			t.Errorf("instance %v was recorded for machine %q", inst.ID, owner)
+		}
+	}
+}
+
+func TestNoReplacementOnceInstanceLeftGroup(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	oldID := *d.InstanceId
+	if err := env.srv.Drop(testGroupID, oldID); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unrelated instance no machine of the store recorded.
+	other := env.driver("other")
+	if err := other.scaleUp(); err != nil {
+		t.Fatal(err)
+	}
+	env.fulfill(t)
+	otherID := env.group(t).Instances[0].ID
+
+	loaded := env.reload(t, d)
+	loaded.GetState()
+	if loaded.InstanceId == nil || *loaded.InstanceId != oldID {
+		t.Fatalf("machine switched to instance %v after its instance left the group", spotinst.StringValue(loaded.InstanceId))
+	}
+
+	env.reload(t, d).Kill()
+	env.reload(t, d).Remove()
+	for _, id := range env.group(t).Detached {
+		if id == otherID {
+			t.Fatalf("removing the machine detached the unrelated instance %v", otherID)
+		}
+	}
+}
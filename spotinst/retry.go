@@ -0,0 +1,239 @@
+package spotinst
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/spotinst/spotinst-sdk-go/spotinst/client"
+)
+
+const (
+	maxRetries        = 4
+	retryInterval     = time.Second
+	retryMaxInterval  = 30 * time.Second
+	retryAfterMaximum = 2 * time.Minute
+)
+
+// retryTransport retries Spotinst API requests that were throttled or hit a
+// server error, waiting as long as the Retry-After header asks or else backing
+// off exponentially. Requests that change something, such as a scale up, are
+// only retried on 429, which Spotinst returns before acting on them: a 503 may
+// come from a proxy after the group was already resized. Reads are also
+// retried on server and network errors.
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	interval := retryInterval
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf(tag+"Cannot retry %v %v, its body cannot be sent again", req.Method, req.URL.Path)
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(req)
+		if attempt == maxRetries || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		wait := withJitter(interval)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				wait = after
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			stdLog(DEBUG, "%v %v returned %v, retrying in %v", req.Method, req.URL.Path, resp.Status, wait.Round(time.Millisecond))
+		} else {
+			stdLog(DEBUG, "%v %v failed: %v, retrying in %v", req.Method, req.URL.Path, err, wait.Round(time.Millisecond))
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+
+		if interval *= 2; interval > retryMaxInterval {
+			interval = retryMaxInterval
+		}
+	}
+}
+
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	if err != nil {
+		_, network := err.(net.Error)
+		return network && idempotent && req.Context().Err() == nil
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode >= 500:
+		return idempotent
+	default:
+		return false
+	}
+}
+
+// retryAfter returns the wait the Retry-After header of resp asks for, given
+// in seconds or as a date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = time.Until(date)
+	} else {
+		return 0, false
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > retryAfterMaximum {
+		wait = retryAfterMaximum
+	}
+	return wait, true
+}
+
+// apiError is a failed Spotinst API call, with the HTTP status and the request
+// ID to quote to Spotinst support.
+type apiError struct {
+	Method    string
+	Path      string
+	Status    int
+	RequestID string
+	Code      string
+	Message   string
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("Spotinst API %v %v returned %v %v", e.Method, e.Path, e.Status, http.StatusText(e.Status))
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request ID %v)", e.RequestID)
+	}
+	if e.Code != "" || e.Message != "" {
+		msg += fmt.Sprintf(": %v: %v", e.Code, e.Message)
+	}
+	return msg
+}
+
+// Retryable reports whether the call may succeed if made again later.
+func (e *apiError) Retryable() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// toAPIError turns the errors of the SDK into an apiError, keeping other errors
+// as they are.
+func toAPIError(err error) error {
+	es, ok := err.(client.Errors)
+	if !ok || len(es) == 0 {
+		return err
+	}
+
+	e := es[0]
+	out := &apiError{
+		RequestID: e.RequestID,
+		Code:      e.Code,
+		Message:   e.Message,
+	}
+	if e.Response != nil {
+		out.Status = e.Response.StatusCode
+		if e.Response.Request != nil {
+			out.Method = e.Response.Request.Method
+			out.Path = e.Response.Request.URL.Path
+		}
+	}
+	for _, other := range es[1:] {
+		out.Message += "; " + other.Code + ": " + other.Message
+	}
+	return out
+}
+
+// isRetryable reports whether err is worth retrying: network failures,
+// throttling and server side errors.
+func isRetryable(err error) bool {
+	switch e := toAPIError(err).(type) {
+	case *apiError:
+		return e.Retryable()
+	case *url.Error, net.Error:
+		return true
+	default:
+		return err == context.DeadlineExceeded
+	}
+}
+
+// statusCode returns the HTTP status of a Spotinst API error, or 0 if err is
+// not one.
+func statusCode(err error) int {
+	if e, ok := toAPIError(err).(*apiError); ok {
+		return e.Status
+	}
+	return 0
+}
+
+// apiProvider converts the errors of a provider to apiErrors.
+type apiProvider struct {
+	p provider
+}
+
+func (a apiProvider) ScaleUp(ctx context.Context, groupID string) (string, string, error) {
+	instanceID, requestID, err := a.p.ScaleUp(ctx, groupID)
+	return instanceID, requestID, toAPIError(err)
+}
+
+func (a apiProvider) ScaleDown(ctx context.Context, groupID string, adjustment int) error {
+	return toAPIError(a.p.ScaleDown(ctx, groupID, adjustment))
+}
+
+func (a apiProvider) Status(ctx context.Context, groupID string) ([]*instance, error) {
+	instances, err := a.p.Status(ctx, groupID)
+	return instances, toAPIError(err)
+}
+
+func (a apiProvider) Detach(ctx context.Context, groupID string, instanceIDs []string) error {
+	return toAPIError(a.p.Detach(ctx, groupID, instanceIDs))
+}
+
+func (a apiProvider) FindRequest(instances []*instance, requestID string) (*instance, error) {
+	return a.p.FindRequest(instances, requestID)
+}
+
+func (a apiProvider) List(ctx context.Context) ([]*groupInfo, error) {
+	groups, err := a.p.List(ctx)
+	return groups, toAPIError(err)
+}
+
+func (a apiProvider) Read(ctx context.Context, groupID string) (*groupInfo, error) {
+	group, err := a.p.Read(ctx, groupID)
+	return group, toAPIError(err)
+}
+
+// stateError returns the error GetState reports along with state.Error.
+func stateError(what string, err error) (state.State, error) {
+	return state.Error, fmt.Errorf(tag+"Failed to get the state of %v: %v", what, strings.TrimPrefix(err.Error(), tag))
+}
@@ -0,0 +1,74 @@
+package spotinst
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+	"github.com/docker/machine/libmachine/state"
+)
+
+func TestRetryThrottledScaleUp(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.Fail(spotinsttest.OpScaleUp, http.StatusTooManyRequests, 1)
+
+	if err := env.driver("m1").scaleUp(); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.srv.Calls(spotinsttest.OpScaleUp); n != 2 {
+		t.Errorf("scale up was called %v times, want 2", n)
+	}
+	if g := env.group(t); g.Target != 1 {
+		t.Errorf("group has target %v, want 1", g.Target)
+	}
+}
+
+func TestNoRetryOfScaleUpOnServerError(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.Fail(spotinsttest.OpScaleUp, http.StatusServiceUnavailable, 1)
+
+	p, err := env.driver("m1").provider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = p.ScaleUp(context.Background(), testGroupID)
+	if code := statusCode(err); code != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want a 503 API error", err)
+	}
+	if n := env.srv.Calls(spotinsttest.OpScaleUp); n != 1 {
+		t.Errorf("scale up was called %v times, want 1", n)
+	}
+}
+
+func TestRetryStatusOnServerError(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.Fail(spotinsttest.OpStatus, http.StatusServiceUnavailable, 1)
+
+	if _, err := env.driver("m1").groupStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.srv.Calls(spotinsttest.OpStatus); n != 2 {
+		t.Errorf("status was called %v times, want 2", n)
+	}
+}
+
+func TestGetStateReportsAPIError(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	env.srv.Fail(spotinsttest.OpStatus, http.StatusBadRequest, 1)
+
+	s, err := env.reload(t, d).GetState()
+	if s != state.Error || err == nil || !strings.Contains(err.Error(), "returned 400 Bad Request") {
+		t.Fatalf("got state %v, %v, want Error with the API status", s, err)
+	}
+}
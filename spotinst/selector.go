@@ -0,0 +1,129 @@
+package spotinst
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// deprecatedElastiGroupIDEnvVar is the misspelled variable the Elastigroup ID
+// was once read from, still honored when SPOTINST_ELASTIGROUP_ID is unset.
+const deprecatedElastiGroupIDEnvVar = "SPOTINST_ELSTIGROUP_ID"
+
+// parseTags parses key=value pairs into a map.
+func parseTags(pairs []string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range pairs {
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf(tag+"Invalid tag %q, must be key=value", pair)
+		}
+		tags[pair[:i]] = pair[i+1:]
+	}
+	return tags, nil
+}
+
+// hasGroupSelector reports whether the Elastigroup is selected by name or tags
+// rather than by ID.
+func (d *Driver) hasGroupSelector() bool {
+	return d.SpotinstElastiGroupName != "" || len(d.SpotinstElastiGroupTags) > 0
+}
+
+// matches reports whether the group has the given name, if any, and all the
+// given tags.
+func (g *groupInfo) matches(name string, tags map[string]string) bool {
+	if name != "" && g.Name != name {
+		return false
+	}
+	for k, v := range tags {
+		if value, ok := g.Tags[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// selectElastiGroup picks the group selected by name and tags out of the groups
+// of the account and sets its ID, which is saved with the machine so that
+// later commands don't select again.
+func (d *Driver) selectElastiGroup(groups []*groupInfo) error {
+	if d.cloudProvider() == CloudProviderAzure && len(d.SpotinstElastiGroupTags) > 0 {
+		return errors.New(tag + "Azure Elastigroups can only be selected by name")
+	}
+
+	var matches []*groupInfo
+	for _, g := range groups {
+		if g.matches(d.SpotinstElastiGroupName, d.SpotinstElastiGroupTags) {
+			matches = append(matches, g)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return errors.New(tag + "No Elastigroup matches " + d.describeGroupSelector() + ", the groups of the account are:" + formatGroups(groups))
+	case 1:
+		stdLog(INFO, "Elastigroup %v (%v) matches %v", matches[0].ID, matches[0].Name, d.describeGroupSelector())
+		d.SpotinstElastiGroupID = matches[0].ID
+		return nil
+	default:
+		return errors.New(tag + "Several Elastigroups match " + d.describeGroupSelector() + ", narrow it down with more tags or use --spotinst-elastigroup-id:" + formatGroups(matches))
+	}
+}
+
+// resolveElastiGroup sets the group ID from the name and tags selecting the
+// group, if given instead.
+func (d *Driver) resolveElastiGroup() error {
+	if d.SpotinstElastiGroupID != "" {
+		return nil
+	}
+	if !d.hasGroupSelector() {
+		return errors.New(tag + "Elastigroup not provided, set its ID, name or tags")
+	}
+
+	p, err := d.provider()
+	if err != nil {
+		return err
+	}
+	groups, err := p.List(context.Background())
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to list Elastigroups: %v", err)
+	}
+	return d.selectElastiGroup(groups)
+}
+
+func (d *Driver) describeGroupSelector() string {
+	var parts []string
+	if d.SpotinstElastiGroupName != "" {
+		parts = append(parts, fmt.Sprintf("name %q", d.SpotinstElastiGroupName))
+	}
+	for _, k := range sortedKeys(d.SpotinstElastiGroupTags) {
+		parts = append(parts, fmt.Sprintf("tag %v=%v", k, d.SpotinstElastiGroupTags[k]))
+	}
+	return strings.Join(parts, " and ")
+}
+
+func formatGroups(groups []*groupInfo) string {
+	if len(groups) == 0 {
+		return " none"
+	}
+
+	var b strings.Builder
+	for _, g := range groups {
+		fmt.Fprintf(&b, "\n  %v  %v", g.ID, g.Name)
+		for _, k := range sortedKeys(g.Tags) {
+			fmt.Fprintf(&b, "  %v=%v", k, g.Tags[k])
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
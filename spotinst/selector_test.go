@@ -0,0 +1,71 @@
+package spotinst
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveElastiGroup(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.AddGroup("sig-staging")
+	env.srv.AddGroup("sig-ci")
+	env.srv.DescribeGroup(testGroupID, "ci-a", map[string]string{"team": "ci", "env": "prod"})
+	env.srv.DescribeGroup("sig-staging", "staging", map[string]string{"team": "web", "env": "staging"})
+	env.srv.DescribeGroup("sig-ci", "ci-b", map[string]string{"team": "ci", "env": "dev"})
+
+	tests := []struct {
+		name   string
+		group  string
+		tags   map[string]string
+		wantID string
+		err    string
+	}{
+		{name: "by name", group: "staging", wantID: "sig-staging"},
+		{name: "by tags", tags: map[string]string{"team": "ci", "env": "dev"}, wantID: "sig-ci"},
+		{name: "by name and tags", group: "ci-a", tags: map[string]string{"team": "ci"}, wantID: testGroupID},
+		{name: "ambiguous", tags: map[string]string{"team": "ci"}, err: "Several Elastigroups match"},
+		{name: "no match", group: "staging", tags: map[string]string{"team": "ci"}, err: "No Elastigroup matches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := env.driver("m1")
+			d.SpotinstElastiGroupID = ""
+			d.SpotinstElastiGroupName = tt.group
+			d.SpotinstElastiGroupTags = tt.tags
+
+			err := d.resolveElastiGroup()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.SpotinstElastiGroupID != tt.wantID {
+				t.Errorf("selected group %q, want %q", d.SpotinstElastiGroupID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestCreateSelectsGroupByName(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.DescribeGroup(testGroupID, "ci", nil)
+
+	d := env.driver("m1")
+	d.SpotinstElastiGroupID = ""
+	d.SpotinstElastiGroupName = "ci"
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if d.SpotinstElastiGroupID != testGroupID {
+		t.Errorf("machine has group %q, want %q", d.SpotinstElastiGroupID, testGroupID)
+	}
+	if g := env.group(t); len(g.Instances) != 1 {
+		t.Errorf("group has %v instances, want 1", len(g.Instances))
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -15,22 +17,36 @@ import (
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnflag"
 	"github.com/docker/machine/libmachine/state"
-	"github.com/spotinst/spotinst-sdk-go/service/elastigroup"
 	"github.com/spotinst/spotinst-sdk-go/service/elastigroup/providers/aws"
 	"github.com/spotinst/spotinst-sdk-go/spotinst"
 	"github.com/spotinst/spotinst-sdk-go/spotinst/credentials"
-	"github.com/spotinst/spotinst-sdk-go/spotinst/session"
 )
 
 const (
-	driverName     = "spotinst"
-	defaultSSHUser = "ubuntu"
-	dockerPort     = 2376
-	sshPorts       = 22
-	tag            = "[SPOTINST DRIVER] "
-	version        = "0.2"
+	driverName      = "spotinst"
+	defaultSSHUser  = "ubuntu"
+	dockerPort      = 2376
+	sshPorts        = 22
+	tag             = "[SPOTINST DRIVER] "
+	scaleAdjustment = 1
+	version         = "0.2"
+
+	defaultRemoveTimeout = 300 // seconds
 )
 
+var errSpotRequestNotFound = errors.New("Spot Request canceled")
+
+type instanceNotFoundError string
+
+func (e instanceNotFoundError) Error() string {
+	return "Cannot find instance " + string(e)
+}
+
+func isInstanceNotFound(err error) bool {
+	_, ok := err.(instanceNotFoundError)
+	return ok
+}
+
 type Config struct {
 	Token   string
 	Account string
@@ -38,28 +54,61 @@ type Config struct {
 
 type Driver struct {
 	*drivers.BaseDriver
-	Id                    string
-	clientFactory         func() Client
-	SpotinstAccount       string
-	SpotinstToken         string
-	SpotinstElastiGroupID string
-	SSHUser               string
-	PublicDNS             *string
-	PrivateIpAddress      *string
-	PublicIpAddress       *string
-	UsePublicIPOnly       bool
-	InstanceId            *string
-	SpotInstanceRequest   string
-}
-
-type Client struct {
-	elastigroup elastigroup.Service
+	Id                        string
+	clientFactory             func() Client
+	client                    Client
+	credentials               *credentials.Credentials
+	credentialProcess         *processProvider
+	cachedStatusReads         bool
+	SpotinstAccount           string
+	SpotinstToken             string
+	SpotinstTokenKeyFile      string
+	SpotinstProfile           string
+	SpotinstAPIURL            string
+	SpotinstHTTPProxy         string
+	SpotinstCABundle          string
+	SpotinstCredentialProcess string
+	SpotinstElastiGroupID     string
+	SpotinstElastiGroupName   string
+	SpotinstElastiGroupTags   map[string]string
+	SpotinstGroupTemplate     string
+	SpotinstCloudProvider     string
+	SpotinstBackend           string
+	SpotinstWarmPool          bool
+	SpotinstTags              map[string]string
+	SSHUser                   string
+	PublicDNS                 *string
+	PrivateIpAddress          *string
+	PublicIpAddress           *string
+	UsePublicIPOnly           bool
+	InstanceId                *string
+	StatefulInstanceId        *string
+	StatefulNodeId            *string
+	SpotInstanceRequest       string
+	RemoveTimeout             int
+	CreateTimeout             int
+	PollInterval              int
+	PollMaxInterval           int
+	PollBackoffFactor         float64
+	RequestTimeout            int
+	StatusCacheTTL            int
+	WaitForCloudInit          bool
+	ExpiresAt                 time.Time
 }
 
 func NewDriver(hostName, storePath string) *Driver {
 	id := generateId()
 	driver := &Driver{
-		Id: id,
+		Id:                    id,
+		SpotinstCloudProvider: CloudProviderAWS,
+		SpotinstBackend:       BackendElastigroup,
+		RemoveTimeout:         defaultRemoveTimeout,
+		CreateTimeout:         defaultCreateTimeout,
+		PollInterval:          defaultPollInterval,
+		PollMaxInterval:       defaultPollMaxInterval,
+		PollBackoffFactor:     defaultPollBackoffFactor,
+		RequestTimeout:        defaultRequestTimeout,
+		StatusCacheTTL:        defaultStatusCacheTTL,
 		BaseDriver: &drivers.BaseDriver{
 			SSHUser:     defaultSSHUser,
 			MachineName: hostName,
@@ -72,8 +121,13 @@ func NewDriver(hostName, storePath string) *Driver {
 	return driver
 }
 
+// getClient returns the client of the driver, built on first use, so that the
+// API calls of a command share its transport and connections.
 func (d *Driver) getClient() Client {
-	return d.clientFactory()
+	if d.client == nil {
+		d.client = d.clientFactory()
+	}
+	return d.client
 }
 
 // Validate returns an error in case of invalid configuration.
@@ -86,32 +140,27 @@ func (d *Driver) BuildClient() Client {
 	config := spotinst.DefaultConfig()
 	config.WithUserAgent("DockerMachine")
 
-	var static *credentials.StaticProvider
-	if d.SpotinstToken != "" || d.SpotinstAccount != "" {
-		static = &credentials.StaticProvider{
-			Value: credentials.Value{
-				Token:   d.SpotinstToken,
-				Account: d.SpotinstAccount,
-			},
-		}
-
+	if err := d.configureEndpoint(config); err != nil {
+		log.Error(err)
+		config.WithHTTPClient(&http.Client{Transport: errorTransport{err}})
 	}
-	creds := credentials.NewCredentials(static)
 
+	creds := d.credentialsChain()
 	if _, err := creds.Get(); err != nil {
 		stdLog(ERROR, "Failed to initiate Spotinst client: %v", err)
 	}
 	config.WithCredentials(creds)
 
-	// Create a new session.
-	sess := session.New(config)
-
-	// Create a new client.
-	client := &Client{
-		elastigroup: elastigroup.New(sess),
+	if d.credentialProcess != nil {
+		config.HTTPClient.Transport = &credentialProcessTransport{
+			base:        config.HTTPClient.Transport,
+			credentials: creds,
+			process:     d.credentialProcess,
+		}
 	}
+	config.HTTPClient.Transport = &retryTransport{base: config.HTTPClient.Transport}
 
-	return *client
+	return NewClient(config)
 }
 
 func generateId() string {
@@ -134,21 +183,151 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "spotinst token",
 			EnvVar: "SPOTINST_TOKEN",
 		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-token-key-file",
+			Usage:  "file holding the key the token is saved encrypted with, instead of the SPOTINST_TOKEN_PASSPHRASE env var",
+			EnvVar: "SPOTINST_TOKEN_KEY_FILE",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-profile",
+			Usage:  "profile of the spotinst credentials file to take the token and account from",
+			EnvVar: "SPOTINST_PROFILE",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-credential-process",
+			Usage:  "command printing the spotinst token, account and expiration as json",
+			EnvVar: "SPOTINST_CREDENTIAL_PROCESS",
+		},
 		mcnflag.StringFlag{
 			Name:   "spotinst-account",
 			Usage:  "spotinst account",
 			EnvVar: "SPOTINST_ACCOUNT",
 		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-api-url",
+			Usage:  "base url of the spotinst api, e.g. of an api gateway",
+			EnvVar: "SPOTINST_API_URL",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-http-proxy",
+			Usage:  "proxy url for the spotinst api, instead of HTTPS_PROXY",
+			EnvVar: "SPOTINST_HTTP_PROXY",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-ca-bundle",
+			Usage:  "pem file of additional certificate authorities to trust for the spotinst api",
+			EnvVar: "SPOTINST_CA_BUNDLE",
+		},
+		mcnflag.IntFlag{
+			Name:   "spotinst-request-timeout",
+			Usage:  "seconds to wait for each spotinst api request, 0 for no limit",
+			Value:  defaultRequestTimeout,
+			EnvVar: "SPOTINST_REQUEST_TIMEOUT",
+		},
 		mcnflag.StringFlag{
 			Name:   "spotinst-elastigroup-id",
 			Usage:  "spotinst elastigroup id",
-			EnvVar: "SPOTINST_ELSTIGROUP_ID",
+			EnvVar: "SPOTINST_ELASTIGROUP_ID",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-elastigroup-name",
+			Usage:  "select the elastigroup by name instead of id",
+			EnvVar: "SPOTINST_ELASTIGROUP_NAME",
+		},
+		mcnflag.StringSliceFlag{
+			Name:   "spotinst-elastigroup-tag",
+			Usage:  "select the elastigroup by a key=value instance tag (label on gcp), repeatable",
+			EnvVar: "SPOTINST_ELASTIGROUP_TAG",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-cloud-provider",
+			Usage:  "cloud provider of the elastigroup: aws, azure or gcp",
+			Value:  CloudProviderAWS,
+			EnvVar: "SPOTINST_CLOUD_PROVIDER",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-backend",
+			Usage:  "spotinst service to get the instance from: elastigroup or stateful-node",
+			Value:  BackendElastigroup,
+			EnvVar: "SPOTINST_BACKEND",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-group-template",
+			Usage:  "spotinst group template file (json/yaml) for a dedicated elastigroup, or the stateful node, per machine",
+			EnvVar: "SPOTINST_GROUP_TEMPLATE",
 		},
 		mcnflag.StringFlag{
 			Name:   "spotinst-sshkey-path",
-			Usage:  "spotinst sshkey path",
+			Usage:  "spotinst sshkey path, required for shared elastigroups, whose instances must already accept the key; generated when empty with --spotinst-group-template",
 			EnvVar: "SPOTINST_SSHKEY_PATH",
 		},
+		mcnflag.IntFlag{
+			Name:   "spotinst-create-timeout",
+			Usage:  "seconds to wait for the instance to be created and reachable",
+			Value:  defaultCreateTimeout,
+			EnvVar: "SPOTINST_CREATE_TIMEOUT",
+		},
+		mcnflag.IntFlag{
+			Name:   "spotinst-poll-interval",
+			Usage:  "initial seconds between status checks while waiting",
+			Value:  defaultPollInterval,
+			EnvVar: "SPOTINST_POLL_INTERVAL",
+		},
+		mcnflag.IntFlag{
+			Name:   "spotinst-poll-max-interval",
+			Usage:  "maximum seconds between status checks while waiting",
+			Value:  defaultPollMaxInterval,
+			EnvVar: "SPOTINST_POLL_MAX_INTERVAL",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-poll-backoff",
+			Usage:  "factor the interval between status checks grows by",
+			Value:  strconv.FormatFloat(defaultPollBackoffFactor, 'f', -1, 64),
+			EnvVar: "SPOTINST_POLL_BACKOFF",
+		},
+		mcnflag.IntFlag{
+			Name:   "spotinst-remove-timeout",
+			Usage:  "seconds to wait for the instance to terminate on remove",
+			Value:  defaultRemoveTimeout,
+			EnvVar: "SPOTINST_REMOVE_TIMEOUT",
+		},
+		mcnflag.IntFlag{
+			Name:   "spotinst-status-cache-ttl",
+			Usage:  "seconds the status of the elastigroup is cached and shared by the machines of the group, 0 to disable",
+			Value:  defaultStatusCacheTTL,
+			EnvVar: "SPOTINST_STATUS_CACHE_TTL",
+		},
+		mcnflag.IntFlag{
+			Name:   "spotinst-ssh-port",
+			Usage:  "ssh port of the instance",
+			Value:  sshPorts,
+			EnvVar: "SPOTINST_SSH_PORT",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-ttl",
+			Usage:  "time to live of the machine, e.g. 8h, after which reap removes it",
+			EnvVar: "SPOTINST_TTL",
+		},
+		mcnflag.StringFlag{
+			Name:   "spotinst-expires-at",
+			Usage:  "rfc 3339 time after which reap removes the machine",
+			EnvVar: "SPOTINST_EXPIRES_AT",
+		},
+		mcnflag.StringSliceFlag{
+			Name:   "spotinst-tag",
+			Usage:  "key=value tag to set on the instance, repeatable; on shared groups only recorded in the machine store",
+			EnvVar: "SPOTINST_TAG",
+		},
+		mcnflag.BoolFlag{
+			Name:   "spotinst-warm-pool",
+			Usage:  "claim a running unclaimed instance of the warm pool of the elastigroup before scaling it up, atomic only within one machine store",
+			EnvVar: "SPOTINST_WARM_POOL",
+		},
+		mcnflag.BoolFlag{
+			Name:   "spotinst-wait-cloud-init",
+			Usage:  "wait for cloud-init to finish before provisioning",
+			EnvVar: "SPOTINST_WAIT_CLOUD_INIT",
+		},
 		mcnflag.BoolFlag{
 			Name:   "use-public-ip",
 			Usage:  "use public ip",
@@ -165,10 +344,77 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.SpotinstAccount = flags.String("spotinst-account")
 	d.SpotinstToken = flags.String("spotinst-token")
+	d.SpotinstProfile = flags.String("spotinst-profile")
+	d.SpotinstCredentialProcess = flags.String("spotinst-credential-process")
+	if d.SpotinstProfile != "" && d.SpotinstCredentialProcess != "" {
+		return errors.New(tag + "Spotinst profile and credential process are mutually exclusive")
+	}
+	if d.SpotinstToken != "" && (d.SpotinstProfile != "" || d.SpotinstCredentialProcess != "") {
+		// Only the profile name or the command is saved with the machine,
+		// never the token they provide.
+		log.Warnf(tag + "Ignoring the Spotinst token, the token of the profile or credential process is used")
+		d.SpotinstToken = ""
+	}
+	d.SpotinstTokenKeyFile = flags.String("spotinst-token-key-file")
+	if err := d.encryptToken(); err != nil {
+		return err
+	}
+	d.SpotinstAPIURL = flags.String("spotinst-api-url")
+	d.SpotinstHTTPProxy = flags.String("spotinst-http-proxy")
+	d.SpotinstCABundle = flags.String("spotinst-ca-bundle")
+	d.RequestTimeout = flags.Int("spotinst-request-timeout")
+	if err := d.configureEndpoint(spotinst.DefaultConfig()); err != nil {
+		return err
+	}
 	d.SpotinstElastiGroupID = flags.String("spotinst-elastigroup-id")
+	if d.SpotinstElastiGroupID == "" && os.Getenv(deprecatedElastiGroupIDEnvVar) != "" {
+		log.Warnf(tag+"%v is deprecated, use SPOTINST_ELASTIGROUP_ID", deprecatedElastiGroupIDEnvVar)
+		d.SpotinstElastiGroupID = os.Getenv(deprecatedElastiGroupIDEnvVar)
+	}
+	d.SpotinstElastiGroupName = flags.String("spotinst-elastigroup-name")
+	groupTags, err := parseTags(flags.StringSlice("spotinst-elastigroup-tag"))
+	if err != nil {
+		return err
+	}
+	d.SpotinstElastiGroupTags = groupTags
+	if d.SpotinstElastiGroupID != "" && d.hasGroupSelector() {
+		return errors.New(tag + "Elastigroup ID and Elastigroup name or tags are mutually exclusive")
+	}
+	d.SpotinstGroupTemplate = flags.String("spotinst-group-template")
+	d.SpotinstCloudProvider = flags.String("spotinst-cloud-provider")
+	if _, err := newProvider(d.SpotinstCloudProvider, nil); err != nil {
+		return err
+	}
+	d.SpotinstBackend = flags.String("spotinst-backend")
+	if d.SpotinstBackend != BackendElastigroup && d.SpotinstBackend != BackendStatefulNode {
+		return fmt.Errorf(tag+"Unsupported backend %q, must be %v or %v", d.SpotinstBackend, BackendElastigroup, BackendStatefulNode)
+	}
+	d.SpotinstWarmPool = flags.Bool("spotinst-warm-pool")
+	instanceTags, err := parseInstanceTags(flags.StringSlice("spotinst-tag"))
+	if err != nil {
+		return err
+	}
+	d.SpotinstTags = instanceTags
+	expiresAt, err := parseExpiry(flags.String("spotinst-ttl"), flags.String("spotinst-expires-at"))
+	if err != nil {
+		return err
+	}
+	d.ExpiresAt = expiresAt
+	d.RemoveTimeout = flags.Int("spotinst-remove-timeout")
+	d.CreateTimeout = flags.Int("spotinst-create-timeout")
+	d.PollInterval = flags.Int("spotinst-poll-interval")
+	d.PollMaxInterval = flags.Int("spotinst-poll-max-interval")
+	d.StatusCacheTTL = flags.Int("spotinst-status-cache-ttl")
+	factor, err := parseBackoffFactor(flags.String("spotinst-poll-backoff"))
+	if err != nil {
+		return err
+	}
+	d.PollBackoffFactor = factor
 	d.UsePublicIPOnly = flags.Bool("use-public-ip")
 	d.SSHUser = flags.String("ssh-user")
 	d.SSHKeyPath = flags.String("spotinst-sshkey-path")
+	d.SSHPort = flags.Int("spotinst-ssh-port")
+	d.WaitForCloudInit = flags.Bool("spotinst-wait-cloud-init")
 
 	return nil
 }
@@ -178,95 +424,236 @@ func (d *Driver) DriverName() string {
 	return driverName
 }
 
+// PreCreateCheck validates the configuration, the credentials, the group and
+// the SSH key, reporting every problem found at once.
 func (d *Driver) PreCreateCheck() error {
+	var p preflight
 
-	if d.SpotinstToken == "" || d.SpotinstAccount == "" {
-		err := errors.New(tag + "Spotinst credentials was not provided")
-		return err
+	_, err := d.credentialsChain().Get()
+	haveCredentials := err == nil
+	if !haveCredentials {
+		p.fail("Spotinst credentials was not provided: %v", err)
 	}
 
-	if d.SSHKeyPath == "" {
-		err := errors.New(tag + "Server SSH Key not provided")
-		return err
+	d.checkSSHKey(&p)
+
+	switch {
+	case d.SpotinstBackend == BackendStatefulNode:
+		if d.cloudProvider() != CloudProviderAWS {
+			p.fail("Stateful nodes are only supported on AWS")
+		}
+		if d.SpotinstGroupTemplate == "" || d.SpotinstElastiGroupID != "" || d.hasGroupSelector() {
+			p.fail("The stateful-node backend needs a template and no Elastigroup ID")
+		} else if _, err := d.loadStatefulNodeTemplate(); err != nil {
+			p.add(err)
+		}
+	case d.SpotinstGroupTemplate != "":
+		if d.cloudProvider() != CloudProviderAWS {
+			p.fail("Group templates are only supported for AWS Elastigroups")
+		}
+		if d.SpotinstElastiGroupID != "" || d.hasGroupSelector() {
+			p.fail("Elastigroup selection and group template are mutually exclusive")
+		}
+		if _, err := d.loadGroupTemplate(); err != nil {
+			p.add(err)
+		}
+	case d.SpotinstElastiGroupID == "" && !d.hasGroupSelector():
+		p.fail("Elastigroup not provided, set its ID, name or tags")
 	}
-	return nil
+
+	if d.SpotinstWarmPool {
+		if err := d.checkWarmPool(); err != nil {
+			p.add(err)
+		}
+	}
+	if len(d.SpotinstTags) > 0 && d.cloudProvider() != CloudProviderAWS {
+		p.fail("Instance tags are only supported on AWS")
+	}
+
+	if haveCredentials {
+		d.checkGroup(&p)
+	}
+
+	return p.err()
 }
 
 func (d *Driver) Create() error {
+	// docker-machine runs PreCreateCheck right before, which selects the
+	// group; only select it here when Create is called on its own.
+	if d.SpotinstElastiGroupID == "" && d.hasGroupSelector() {
+		if err := d.resolveElastiGroup(); err != nil {
+			return err
+		}
+	}
 
-	if err := d.PreCreateCheck(); err != nil {
+	if err := d.generateSSHKey(); err != nil {
 		return err
 	}
 
-	if err := d.innerCreate(); err != nil {
-		d.Remove()
+	ctx, cancel := d.createContext()
+	defer cancel()
+
+	if err := d.innerCreate(ctx); err != nil {
+		stdLog(ERROR, "Create failed: %v, rolling back", err)
+		if rollbackErr := d.Remove(); rollbackErr != nil {
+			return fmt.Errorf("%v; rollback failed: %v", err, rollbackErr)
+		}
 		return err
 	}
 
-	return nil
+	return d.clearCreateProgress()
 }
 
-func (d *Driver) innerCreate() error {
+func (d *Driver) innerCreate(ctx context.Context) error {
 	stdLog(INFO, "Spotinst Driver version %v", version)
 	stdLog(DEBUG, "Creating new server for you...")
-	var scaleType = "up"
-	var adjustment = 1
-	input := new(aws.ScaleGroupInput)
-	input.Adjustment = &adjustment
-	input.GroupID = &d.SpotinstElastiGroupID
-	input.ScaleType = &scaleType
-	output, e := d.getClient().elastigroup.CloudProviderAWS().Scale(context.Background(), input)
-	if e != nil {
-		stdLog(ERROR, "Client initialized failed %v", e.Error())
-		return e
-	}
 
-	if len(output.Items) == 0 {
-		err := errors.New("No server created as result of scale")
-		log.Error(tag+"%v", err.Error())
+	return d.backend().Create(ctx)
+}
+
+func (d *Driver) createInElastigroup(ctx context.Context) error {
+	progress, err := d.restoreCreateProgress()
+	if err != nil {
 		return err
 	}
+	if progress != nil {
+		stdLog(INFO, "Resuming create from phase %v", progress.Phase)
+	}
 
-	scaleResultItem := output.Items[0]
+	if d.SpotinstGroupTemplate != "" {
+		return d.createDedicatedGroup(ctx)
+	}
 
-	// Handle spotrequest
-	if scaleResultItem.NewSpotRequests != nil && scaleResultItem.NewInstances == nil {
-		spotInstanceRequestID := scaleResultItem.NewSpotRequests[0].SpotInstanceRequestID
-		stdLog(DEBUG, "SpotRequest: %v", spotinst.StringValue(spotInstanceRequestID))
-
-		if spotInstanceRequestID != nil {
-			err := d.waitForInstanceSpot(spotInstanceRequestID)
-			if err != nil {
-				log.Errorf(tag + "Failed to get server from spot request " + e.Error())
+	if progress == nil {
+		claimed := false
+		if d.SpotinstWarmPool {
+			if claimed, err = d.claimPoolInstance(); err != nil {
 				return err
 			}
-		} else {
+		}
+		if !claimed {
+			if err := d.scaleUp(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Handle spotrequest
+	if d.InstanceId == nil {
+		if d.SpotInstanceRequest == "" {
 			stdLog(ERROR, "Failed to get spot request")
 			err := errors.New("Failed to get spot request")
 			return err
 		}
 
-		errInst := d.waitForInstanceStart()
+		err := d.waitForInstanceSpot(ctx, &d.SpotInstanceRequest)
+		if err != nil {
+			log.Errorf(tag+"Failed to get server from spot request %v", err)
+			return err
+		}
 
-		if errInst != nil {
-			stdLog(ERROR, "Instance failed to start: %v, Initiate kill", e.Error())
-			return errInst
+		if err := d.saveCreateProgress(CreatePhaseInstanceAssigned); err != nil {
+			return err
 		}
+	}
 
-	} else if scaleResultItem.NewInstances != nil {
-		d.InstanceId = scaleResultItem.NewInstances[0].InstanceID
+	if err := d.recordInstance(); err != nil {
+		log.Warn(err)
 	}
 
-	if scaleResultItem.NewInstances != nil {
-		err := d.waitForInstanceStart()
+	if err := d.waitForInstanceStart(ctx); err != nil {
+		stdLog(ERROR, "Instance failed to start: %v, Initiate kill", err)
+		return err
+	}
+
+	if err := d.saveCreateProgress(CreatePhaseRunning); err != nil {
+		return err
+	}
+
+	return d.waitForSSH(ctx)
+}
+
+func (d *Driver) scaleUp() error {
+	p, err := d.provider()
+	if err != nil {
+		return err
+	}
+
+	instanceID, requestID, e := p.ScaleUp(context.Background(), d.SpotinstElastiGroupID)
+	if e != nil {
+		stdLog(ERROR, "Client initialized failed %v", e)
+		return e
+	}
+
+	if instanceID != "" {
+		d.InstanceId = spotinst.String(instanceID)
+		return d.saveCreateProgress(CreatePhaseInstanceAssigned)
+	}
+
+	if requestID != "" {
+		stdLog(DEBUG, "SpotRequest: %v", requestID)
+		d.SpotInstanceRequest = requestID
+	}
+
+	// Saved even without a spot request, so a rollback still scales back down.
+	return d.saveCreateProgress(CreatePhaseSpotRequested)
+}
 
+func (d *Driver) createDedicatedGroup(ctx context.Context) error {
+	if d.SpotinstElastiGroupID == "" {
+		group, err := d.loadGroupTemplate()
 		if err != nil {
-			stdLog(ERROR, "Instance failed to start: %v, Initiate kill", e.Error())
+			return err
+		}
+
+		if group.Compute.LaunchSpecification == nil {
+			group.Compute.LaunchSpecification = new(aws.LaunchSpecification)
+		}
+		if err := d.injectSSHKey(&group.Compute.LaunchSpecification.UserData); err != nil {
+			return err
+		}
+		d.tagGroupTemplate(group.Compute.LaunchSpecification)
+
+		input := new(aws.CreateGroupInput)
+		input.Group = group
+		output, e := d.getClient().CloudProviderAWS().Create(context.Background(), input)
+		if e != nil {
+			stdLog(ERROR, "Failed to create group: %v", e)
+			return e
+		}
+
+		if output.Group == nil || output.Group.ID == nil {
+			err := errors.New(tag + "No group created from template")
+			return err
+		}
+
+		d.SpotinstElastiGroupID = *output.Group.ID
+		stdLog(INFO, "Created dedicated group %v", d.SpotinstElastiGroupID)
+
+		if err := d.saveCreateProgress(CreatePhaseGroupCreated); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	if d.InstanceId == nil {
+		if err := d.waitForGroupInstance(ctx); err != nil {
+			return err
+		}
+
+		if err := d.saveCreateProgress(CreatePhaseInstanceAssigned); err != nil {
+			return err
+		}
+	}
+
+	if err := d.waitForInstanceStart(ctx); err != nil {
+		return err
+	}
+
+	if err := d.saveCreateProgress(CreatePhaseRunning); err != nil {
+		return err
+	}
+
+	return d.waitForSSH(ctx)
 }
 
 func (d *Driver) GetURL() (string, error) {
@@ -288,6 +675,14 @@ func (d *Driver) GetURL() (string, error) {
 
 func (d *Driver) GetIP() (string, error) {
 
+	// Refresh the IPs, which change when the instance is replaced, keeping
+	// the saved ones if Spotinst cannot be reached.
+	if d.InstanceId != nil {
+		if _, err := d.GetState(); err != nil {
+			stdLog(DEBUG, "Cannot refresh instance %v: %v", *d.InstanceId, err)
+		}
+	}
+
 	if d.UsePublicIPOnly {
 		if d.PublicIpAddress == nil {
 			return "", fmt.Errorf("No public IP for instance %v", d.InstanceId)
@@ -303,32 +698,49 @@ func (d *Driver) GetIP() (string, error) {
 }
 
 func (d *Driver) GetState() (state.State, error) {
+	d.warnExpiry()
+	return d.backend().State()
+}
+
+func (d *Driver) elastigroupState() (state.State, error) {
+	d.cachedStatusReads = true
+	defer func() { d.cachedStatusReads = false }()
+
+	if d.StatefulInstanceId != nil {
+		statefulInstance, err := d.getStatefulInstance()
+		if err != nil {
+			return stateError("stateful instance "+*d.StatefulInstanceId, err)
+		}
+		switch spotinst.StringValue(statefulInstance.State) {
+		case StatefulInstanceStatePausing, StatefulInstanceStateDeallocating:
+			return state.Stopping, nil
+		case StatefulInstanceStatePaused:
+			return state.Stopped, nil
+		case StatefulInstanceStateResuming, StatefulInstanceStateRecycling:
+			return state.Starting, nil
+		case StatefulInstanceStateDeallocated, StatefulInstanceStateError:
+			return state.Error, fmt.Errorf(tag+"Stateful instance %v is %v", *d.StatefulInstanceId, spotinst.StringValue(statefulInstance.State))
+		case StatefulInstanceStateActive:
+			if statefulInstance.InstanceID == nil {
+				return state.Starting, nil
+			}
+			d.InstanceId = statefulInstance.InstanceID
+		}
+	}
+
+	// A create that stopped before an instance was launched leaves none.
+	if d.InstanceId == nil {
+		return state.None, nil
+	}
 
-	instance, err := d.getInstanceStatus()
+	instance, err := d.currentInstance()
 	if err != nil {
-		return state.Error, nil
-	}
-	switch *instance.Status {
-	case InstanceStateNamePending:
-		return state.Starting, nil
-	case InstanceStateNameRunning:
-		return state.Running, nil
-	case InstanceStateNameStopping:
-		return state.Stopping, nil
-	case InstanceStateNameShuttingDown:
-		return state.Stopping, nil
-	case InstanceStateNameStopped:
-		return state.Stopped, nil
-	case InstanceStateNameTerminated:
-		return state.Error, nil
-	case InstanceStateNamePendingEvaluation:
-		return state.Starting, nil
-	case InstanceStateNameFullfiled:
-		return state.Running, nil
-	default:
-		log.Warnf(tag+"unrecognized instance state: %v", *instance.Status)
-		return state.Error, nil
+		return stateError("instance "+spotinst.StringValue(d.InstanceId), err)
 	}
+	if instance.State == state.Error {
+		return state.Error, fmt.Errorf(tag+"Instance %v is %v", instance.ID, instance.Status)
+	}
+	return instance.State, nil
 }
 
 func (d *Driver) GetSSHHostname() (string, error) {
@@ -344,7 +756,9 @@ func (d *Driver) GetSSHUsername() string {
 }
 
 func (d *Driver) GetSSHPort() (int, error) {
-	d.SSHPort = sshPorts
+	if d.SSHPort == 0 {
+		d.SSHPort = sshPorts
+	}
 	stdLog(DEBUG, "Found SSH Port %v", d.SSHPort)
 	return d.SSHPort, nil
 }
@@ -355,191 +769,483 @@ func (d *Driver) GetSSHKeyPath() string {
 }
 
 func (d *Driver) Start() error {
-	fmt.Errorf(tag + "Spotinst not support start instance function")
-	return nil
+	return d.backend().Start()
 }
 
 func (d *Driver) Stop() error {
-	fmt.Errorf(tag + "Spotinst not support stop instance function")
-	return nil
+	return d.backend().Stop()
 }
 
 func (d *Driver) Restart() error {
-	fmt.Errorf(tag + "Spotinst not support restart instance function")
-	return nil
+	return d.backend().Restart()
 }
 
 func (d *Driver) Kill() error {
-	input := new(aws.DetachGroupInput)
+	return d.backend().Kill()
+}
 
+func (d *Driver) Remove() error {
+	return d.backend().Remove()
+}
+
+func (d *Driver) resumeStatefulInstance() error {
+	statefulInstance, err := d.getStatefulInstance()
+	if err != nil {
+		return err
+	}
+
+	stdLog(INFO, "Resuming stateful instance %v", spotinst.StringValue(statefulInstance.StatefulInstanceID))
+	input := new(aws.ResumeStatefulInstanceInput)
 	input.GroupID = &d.SpotinstElastiGroupID
+	input.StatefulInstanceID = statefulInstance.StatefulInstanceID
+	_, err = d.getClient().CloudProviderAWS().ResumeStatefulInstance(context.Background(), input)
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to resume instance: %v", toAPIError(err))
+	}
+
+	if err := d.waitForState(state.Running); err != nil {
+		return err
+	}
+	return d.refreshInstanceIPs()
+}
+
+func (d *Driver) pauseStatefulInstance() error {
+	statefulInstance, err := d.getStatefulInstance()
+	if err != nil {
+		return err
+	}
+
+	stdLog(INFO, "Pausing stateful instance %v", spotinst.StringValue(statefulInstance.StatefulInstanceID))
+	input := new(aws.PauseStatefulInstanceInput)
+	input.GroupID = &d.SpotinstElastiGroupID
+	input.StatefulInstanceID = statefulInstance.StatefulInstanceID
+	_, err = d.getClient().CloudProviderAWS().PauseStatefulInstance(context.Background(), input)
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to pause instance: %v", toAPIError(err))
+	}
+
+	return d.waitForState(state.Stopped)
+}
+
+func (d *Driver) recycleStatefulInstance() error {
+	statefulInstance, err := d.getStatefulInstance()
+	if err != nil {
+		return err
+	}
+
+	stdLog(INFO, "Recycling stateful instance %v", spotinst.StringValue(statefulInstance.StatefulInstanceID))
+	input := new(aws.RecycleStatefulInstanceInput)
+	input.GroupID = &d.SpotinstElastiGroupID
+	input.StatefulInstanceID = statefulInstance.StatefulInstanceID
+	_, err = d.getClient().CloudProviderAWS().RecycleStatefulInstance(context.Background(), input)
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to recycle instance: %v", toAPIError(err))
+	}
+
+	if err := d.waitForRecycle(spotinst.StringValue(statefulInstance.InstanceID)); err != nil {
+		return err
+	}
+	if err := d.waitForState(state.Running); err != nil {
+		return err
+	}
+	return d.refreshInstanceIPs()
+}
+
+func (d *Driver) detachFromElastigroup() error {
 	if d.InstanceId == nil {
 		return nil
 	}
 
-	input.InstanceIDs = []string{*d.InstanceId}
-	decrement := true
-	input.ShouldDecrementTargetCapacity = &decrement
-	d.getClient().elastigroup.CloudProviderAWS().Detach(context.Background(), input)
+	timeout := d.RemoveTimeout
+	if timeout <= 0 {
+		timeout = defaultRemoveTimeout
+	}
 
-	return nil
+	// Not bound to the interrupt context: Remove is how an interrupted
+	// Create rolls back.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	if err := d.checkOwnership(); err != nil {
+		return err
+	}
+
+	if err := d.detachInstance(ctx); err != nil {
+		return err
+	}
+
+	return d.waitForInstanceTermination(ctx)
 }
 
-func (d *Driver) Remove() error {
-	return d.Kill()
+func (d *Driver) removeFromElastigroup() error {
+	progress, err := d.restoreCreateProgress()
+	if err != nil {
+		return err
+	}
+
+	if d.SpotinstGroupTemplate != "" {
+		if err := d.deleteGroup(); err != nil {
+			return err
+		}
+		return d.clearCreateProgress()
+	}
+
+	if d.InstanceId == nil && progress != nil && progress.Phase == CreatePhaseSpotRequested {
+		if err := d.adoptOrCancelSpotRequest(); err != nil {
+			return err
+		}
+	}
+
+	if err := d.Kill(); err != nil {
+		return err
+	}
+
+	return d.clearCreateProgress()
 }
 
 //region Helpers
-func (d *Driver) getSpotRequestStatus(spotRequestId *string) (*aws.Instance, error) {
+func (d *Driver) getSpotRequestStatus(spotRequestId *string) (*instance, error) {
 
 	spotReqParam := spotinst.StringValue(spotRequestId)
-	input := new(aws.StatusGroupInput)
-	input.GroupID = &d.SpotinstElastiGroupID
+	p, e := d.provider()
+	if e != nil {
+		return nil, e
+	}
+
+	instances, e := p.Status(context.Background(), d.SpotinstElastiGroupID)
+
+	if e != nil {
+		return nil, e
+	}
+
+	instance, e := d.claimLaunchedInstance(p, instances, spotReqParam)
+	if e == errSpotRequestNotFound {
+		stdLog(DEBUG, "did not find status for spot request %v", spotReqParam)
+	}
+	return instance, e
+}
 
-	output, e := d.getClient().elastigroup.CloudProviderAWS().Status(context.Background(), input)
+func (d *Driver) getInstanceStatus() (*instance, error) {
+	instances, e := d.groupStatus()
 
 	if e != nil {
 		return nil, e
 	}
 
-	if output != nil && output.Instances != nil && len(output.Instances) > 0 {
-		for _, v := range output.Instances {
+	for _, v := range instances {
+		if v.ID == *d.InstanceId {
+			return v, nil
+		}
+	}
+
+	return nil, instanceNotFoundError(*d.InstanceId)
+}
 
-			spotReq := spotinst.StringValue(v.SpotRequestID)
+// detachInstance detaches the instance from the group, terminating it and
+// decrementing the target capacity. Transient errors are retried with backoff
+// until ctx is done.
+func (d *Driver) detachInstance(ctx context.Context) error {
+	p, err := d.provider()
+	if err != nil {
+		return err
+	}
 
-			if spotReq == spotReqParam {
+	var lastErr error
+	err = d.waitFor(ctx, "detach of instance "+*d.InstanceId, func() (bool, error) {
+		err := p.Detach(context.Background(), d.SpotinstElastiGroupID, []string{*d.InstanceId})
+		if err == nil {
+			stdLog(INFO, "Detached instance %v from group %v", *d.InstanceId, d.SpotinstElastiGroupID)
+			return true, nil
+		}
 
-				if v != nil && v.ID != nil {
-					return v, nil
-				} else {
-					return nil, nil
-				}
+		if !isRetryable(err) {
+			// The instance may already be gone, e.g. detached by an earlier Remove.
+			if _, statusErr := d.getInstanceStatus(); isInstanceNotFound(statusErr) {
+				stdLog(INFO, "Instance %v is no longer in group %v", *d.InstanceId, d.SpotinstElastiGroupID)
+				return true, nil
 			}
+			return false, fmt.Errorf(tag+"Failed to detach instance %v: %v", *d.InstanceId, err)
 		}
+
+		stdLog(WARN, "Detach of instance %v failed: %v", *d.InstanceId, err)
+		lastErr = err
+		return false, nil
+	})
+
+	if err != nil && lastErr != nil {
+		return fmt.Errorf("%v: %v", err, lastErr)
 	}
+	return err
+}
 
-	stdLog(DEBUG, "did not find status for spot request %v", spotRequestId)
-	err := errors.New("Spot Request canceled")
-	return nil, err
+// waitForInstanceTermination polls the group status until the instance has
+// left the group or is shutting down.
+func (d *Driver) waitForInstanceTermination(ctx context.Context) error {
+	var lastErr error
+	err := d.waitFor(ctx, "termination of instance "+*d.InstanceId, func() (bool, error) {
+		inst, err := d.getInstanceStatus()
+		if isInstanceNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+
+		if inst.Gone {
+			return true, nil
+		}
+		lastErr = fmt.Errorf("instance is still %v", inst.Status)
+		return false, nil
+	})
+
+	if err != nil {
+		return fmt.Errorf(tag+"Cannot confirm termination of instance %v: %v", *d.InstanceId, lastErr)
+	}
+	return nil
 }
 
-func (d *Driver) getInstanceStatus() (*aws.Instance, error) {
-	input := new(aws.StatusGroupInput)
-	input.GroupID = &d.SpotinstElastiGroupID
-	output, e := d.getClient().elastigroup.CloudProviderAWS().Status(context.Background(), input)
+// adoptOrCancelSpotRequest resolves the spot request of an unfinished Create.
+func (d *Driver) adoptOrCancelSpotRequest() error {
+	if d.SpotInstanceRequest == "" {
+		return d.scaleDown(scaleAdjustment)
+	}
+
+	instance, err := d.getSpotRequestStatus(&d.SpotInstanceRequest)
+	if err != nil && err != errSpotRequestNotFound {
+		return fmt.Errorf(tag+"Failed to check spot request %v: %v", d.SpotInstanceRequest, err)
+	}
+	if instance != nil {
+		stdLog(INFO, "Adopting instance %v of spot request %v", instance.ID, d.SpotInstanceRequest)
+		d.InstanceId = spotinst.String(instance.ID)
+		return nil
+	}
+
+	if err == errSpotRequestNotFound {
+		stdLog(INFO, "Spot request %v no longer exists, scaling group %v back down", d.SpotInstanceRequest, d.SpotinstElastiGroupID)
+	} else {
+		stdLog(INFO, "Spot request %v is pending, scaling group %v down to drop it", d.SpotInstanceRequest, d.SpotinstElastiGroupID)
+	}
+	if err := d.scaleDown(scaleAdjustment); err != nil {
+		return err
+	}
+
+	instance, err = d.getSpotRequestStatus(&d.SpotInstanceRequest)
+	switch {
+	case instance != nil:
+		stdLog(WARN, "Spot request %v launched instance %v before the scale down, detaching it", d.SpotInstanceRequest, instance.ID)
+		d.InstanceId = spotinst.String(instance.ID)
+		return nil
+	case err == errSpotRequestNotFound:
+		stdLog(INFO, "Spot request %v was cancelled", d.SpotInstanceRequest)
+	case err != nil:
+		stdLog(WARN, "Cannot check spot request %v after the scale down: %v", d.SpotInstanceRequest, err)
+	default:
+		stdLog(WARN, "Spot request %v is still pending after the scale down, check group %v for an instance it may launch", d.SpotInstanceRequest, d.SpotinstElastiGroupID)
+	}
+
+	d.SpotInstanceRequest = ""
+	return nil
+}
+
+func (d *Driver) scaleDown(adjustment int) error {
+	p, err := d.provider()
+	if err != nil {
+		return err
+	}
+
+	err = p.ScaleDown(context.Background(), d.SpotinstElastiGroupID, adjustment)
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to scale down group %v by %v: %v", d.SpotinstElastiGroupID, adjustment, err)
+	}
+
+	stdLog(INFO, "Scaled down group %v by %v", d.SpotinstElastiGroupID, adjustment)
+	return nil
+}
+
+func (d *Driver) deleteGroup() error {
+	if d.SpotinstElastiGroupID == "" {
+		return nil
+	}
+
+	input := new(aws.DeleteGroupInput)
+	input.GroupID = spotinst.String(d.SpotinstElastiGroupID)
+	_, err := d.getClient().CloudProviderAWS().Delete(context.Background(), input)
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to delete group %v: %v", d.SpotinstElastiGroupID, toAPIError(err))
+	}
+
+	stdLog(INFO, "Deleted dedicated group %v", d.SpotinstElastiGroupID)
+	return nil
+}
+
+func (d *Driver) waitForGroupInstance(ctx context.Context) error {
+	stdLog(DEBUG, "waiting for group to launch an instance...")
+	return d.waitFor(ctx, "group "+d.SpotinstElastiGroupID+" to launch an instance", func() (bool, error) {
+		instances, err := d.groupStatus()
+
+		if err != nil {
+			return false, err
+		}
+
+		for _, v := range instances {
+			if v.ID != "" {
+				stdLog(DEBUG, "Instance found %v", v.ID)
+				d.InstanceId = spotinst.String(v.ID)
+				return true, nil
+			}
+		}
+
+		return false, nil
+	})
+}
+
+func (d *Driver) getStatefulInstance() (*aws.StatefulInstance, error) {
+	if d.cloudProvider() != CloudProviderAWS {
+		return nil, errors.New(tag + "Stateful instances are only supported for AWS Elastigroups, start/stop/restart are not supported")
+	}
+
+	input := new(aws.ListStatefulInstancesInput)
+	input.GroupID = spotinst.String(d.SpotinstElastiGroupID)
+	output, e := d.getClient().CloudProviderAWS().ListStatefulInstances(context.Background(), input)
 
 	if e != nil {
-		return nil, e
+		return nil, fmt.Errorf(tag+"Failed to list stateful instances of group %v: %v", d.SpotinstElastiGroupID, toAPIError(e))
+	}
+
+	if len(output.StatefulInstances) == 0 {
+		return nil, fmt.Errorf(tag+"Elastigroup %v is not stateful, start/stop/restart are not supported", d.SpotinstElastiGroupID)
 	}
 
-	if len(output.Instances) > 0 {
-		for _, v := range output.Instances {
-			if *v.ID == *d.InstanceId {
+	for _, v := range output.StatefulInstances {
+		if d.StatefulInstanceId != nil {
+			if spotinst.StringValue(v.StatefulInstanceID) == *d.StatefulInstanceId {
 				return v, nil
 			}
+		} else if d.InstanceId != nil && spotinst.StringValue(v.InstanceID) == *d.InstanceId {
+			d.StatefulInstanceId = v.StatefulInstanceID
+			return v, nil
 		}
 	}
 
-	err := errors.New("Cannot find instance " + *d.InstanceId)
+	err := fmt.Errorf(tag+"Cannot find stateful instance for instance %v", spotinst.StringValue(d.InstanceId))
 	return nil, err
 }
 
-func (d *Driver) waitForInstanceStart() error {
-	laps := 15
-	stdLog(DEBUG, "waiting for instance Ip...", nil)
-	for d.PublicIpAddress == nil && d.PrivateIpAddress == nil && laps != 0 {
+func (d *Driver) waitForState(desired state.State) error {
+	ctx, cancel := d.createContext()
+	defer cancel()
+
+	stdLog(DEBUG, "waiting for instance to be %v...", desired)
+	return d.waitFor(ctx, fmt.Sprintf("instance %v to be %v", spotinst.StringValue(d.InstanceId), desired), func() (bool, error) {
+		current, err := d.GetState()
+		if err != nil {
+			return false, err
+		}
+
+		stdLog(DEBUG, "Instance is %v", current)
+		return current == desired, nil
+	})
+}
+
+// waitForRecycle waits until a recycle of the instance took effect: the
+// instance is no longer running, or another one replaced it. Spotinst keeps
+// reporting the old instance as running for a while after the call.
+func (d *Driver) waitForRecycle(instanceID string) error {
+	ctx, cancel := d.createContext()
+	defer cancel()
+
+	return d.waitFor(ctx, fmt.Sprintf("instance %v to be recycled", instanceID), func() (bool, error) {
+		current, err := d.GetState()
+		if err != nil {
+			return false, err
+		}
+		return current != state.Running || spotinst.StringValue(d.InstanceId) != instanceID, nil
+	})
+}
+
+func (d *Driver) refreshInstanceIPs() error {
+	inst, e := d.getInstanceStatus()
+
+	if e != nil {
+		return e
+	}
+
+	if inst.PrivateIP != "" {
+		d.PrivateIpAddress = spotinst.String(inst.PrivateIP)
+	}
+	if inst.PublicIP != "" {
+		d.PublicIpAddress = spotinst.String(inst.PublicIP)
+	}
+
+	return nil
+}
+
+func (d *Driver) waitForInstanceStart(ctx context.Context) error {
+	stdLog(DEBUG, "waiting for instance Ip...")
+	return d.waitFor(ctx, "instance "+*d.InstanceId+" IP", func() (bool, error) {
+		if d.PublicIpAddress != nil || d.PrivateIpAddress != nil {
+			return true, nil
+		}
+
 		inst, e := d.getInstanceStatus()
 
 		if e != nil {
-			return e
+			return false, e
 		}
 
 		if d.UsePublicIPOnly {
 			publicIP := inst.PublicIP
-			if publicIP != nil {
+			if publicIP != "" {
 				stdLog(DEBUG, "Found public IP %v", publicIP)
-				d.PublicIpAddress = publicIP
-				return nil
+				d.PublicIpAddress = spotinst.String(publicIP)
+				return true, nil
 			}
 		} else {
 			privateIP := inst.PrivateIP
-			if privateIP != nil {
+			if privateIP != "" {
 				stdLog(DEBUG, "Found private IP %v", privateIP)
-				d.PrivateIpAddress = privateIP
-				return nil
+				d.PrivateIpAddress = spotinst.String(privateIP)
+				return true, nil
 			}
 		}
 
-		laps = laps - 1
-		stdLog(DEBUG, "Waiting for instance IP %v retries left", strconv.Itoa(laps))
-		time.Sleep(20 * time.Second)
-	}
-
-	err := errors.New("Wait to instance " + *d.InstanceId + "reached timeout")
-	return err
-
+		return false, nil
+	})
 }
 
-func (d *Driver) waitForInstanceSpot(spotInstanceRequestID *string) error {
-	laps := 10
+func (d *Driver) waitForInstanceSpot(ctx context.Context, spotInstanceRequestID *string) error {
 	stdLog(DEBUG, "waiting for spot request to get instance.. ")
-	for d.InstanceId == nil && laps != 0 {
-		stdLog(INFO, "Check spot request status", nil)
+	return d.waitFor(ctx, "spot request "+spotinst.StringValue(spotInstanceRequestID), func() (bool, error) {
+		stdLog(INFO, "Check spot request status")
 		instance, err := d.getSpotRequestStatus(spotInstanceRequestID)
 
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		if instance != nil {
-			stdLog(DEBUG, "Instance found %v", spotinst.StringValue(instance.ID))
-			d.InstanceId = instance.ID
-			return nil
+			stdLog(DEBUG, "Instance found %v", instance.ID)
+			d.InstanceId = spotinst.String(instance.ID)
+			return true, nil
 		}
 
-		laps = laps - 1
-		stdLog(DEBUG, "Waiting for instance  %v retries left", strconv.Itoa(laps))
-		time.Sleep(20 * time.Second)
-
-	}
-
-	err := errors.New("Wait to spot" + *spotInstanceRequestID + "reached timeout")
-
-	return err
+		return false, nil
+	})
 }
 
 func stdLog(logSeverity string, fmtString string, args ...interface{}) {
 	switch logSeverity {
 	case DEBUG:
-		if args != nil {
-			log.Debugf(tag+fmtString, args)
-		} else {
-			log.Debugf(tag + fmtString)
-		}
+		log.Debugf(tag+fmtString, args...)
 	case INFO:
-		if args != nil {
-			log.Infof(tag+fmtString, args)
-		} else {
-			log.Infof(tag + fmtString)
-		}
+		log.Infof(tag+fmtString, args...)
 	case WARN:
-		if args != nil {
-			log.Warnf(tag+fmtString, args)
-		} else {
-			log.Warnf(tag + fmtString)
-		}
+		log.Warnf(tag+fmtString, args...)
 	case ERROR:
-		if args != nil {
-			log.Error(tag+fmtString, args)
-		} else {
-			log.Error(tag + fmtString)
-		}
+		log.Errorf(tag+fmtString, args...)
 	default:
-		if args != nil {
-			log.Infof(tag+fmtString, args)
-		} else {
-			log.Infof(tag + fmtString)
-		}
+		log.Infof(tag+fmtString, args...)
 	}
 }
 
@@ -0,0 +1,331 @@
+package spotinst
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/spotinst/spotinst-sdk-go/service/elastigroup/providers/aws"
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+)
+
+const testGroupID = "sig-test"
+
+// testEnv is a fake Spotinst API with one empty AWS group, a stand-in sshd the
+// instances are reached at, and a machine store.
+type testEnv struct {
+	srv   *spotinsttest.Server
+	ssh   *spotinsttest.SSHServer
+	store string
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	store, err := ioutil.TempDir("", "spotinst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshd, err := spotinsttest.NewSSHServer()
+	if err != nil {
+		os.RemoveAll(store)
+		t.Fatal(err)
+	}
+
+	srv := spotinsttest.NewServer()
+	srv.InstanceIP = "127.0.0.1"
+	srv.AddGroup(testGroupID)
+	return &testEnv{srv: srv, ssh: sshd, store: store}
+}
+
+func (e *testEnv) Close() {
+	e.srv.Close()
+	e.ssh.Close()
+	os.RemoveAll(e.store)
+}
+
+func (e *testEnv) client() Client {
+	return NewClient(e.srv.Config())
+}
+
+// driver returns a driver of the store for a new machine in the test group,
+// polling every second.
+func (e *testEnv) driver(name string) *Driver {
+	d := NewDriver(name, e.store)
+	d.SpotinstElastiGroupID = testGroupID
+	d.SpotinstAPIURL = e.srv.URL
+	d.SpotinstToken = spotinsttest.Token
+	d.SpotinstAccount = spotinsttest.Account
+	d.SSHPort = e.ssh.Port()
+	d.PollInterval = 1
+	d.PollMaxInterval = 1
+	d.PollBackoffFactor = 1
+	d.StatusCacheTTL = 0
+	return d
+}
+
+// reload returns the driver docker-machine would load from the saved
+// configuration of the machine.
+func (e *testEnv) reload(t *testing.T, d *Driver) *Driver {
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewDriver(d.MachineName, e.store)
+	if err := json.Unmarshal(b, loaded); err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+// fulfill has the server fulfill the spot requests that are due, as any
+// status call of the group does.
+func (e *testEnv) fulfill(t *testing.T) {
+	input := &aws.StatusGroupInput{GroupID: spotinst.String(testGroupID)}
+	if _, err := e.client().CloudProviderAWS().Status(context.Background(), input); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (e *testEnv) group(t *testing.T) *spotinsttest.Group {
+	g := e.srv.Group(testGroupID)
+	if g == nil {
+		t.Fatalf("group %v is gone", testGroupID)
+	}
+	return g
+}
+
+// records returns the instance records of the test group in the store.
+func (e *testEnv) records(t *testing.T) map[string]map[string]string {
+	records, err := e.driver("").instanceRecords(testGroupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestCreateWaitsForSpotRequest(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.Script(testGroupID, spotinsttest.SpotRequest{Delay: 1})
+
+	d := env.driver("m1")
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	g := env.group(t)
+	if g.Target != 1 || len(g.Instances) != 1 {
+		t.Fatalf("group has target %v and %v instances, want 1 and 1", g.Target, len(g.Instances))
+	}
+	inst := g.Instances[0]
+	if d.InstanceId == nil || *d.InstanceId != inst.ID {
+		t.Fatalf("machine has instance %v, want %v", d.InstanceId, inst.ID)
+	}
+	if d.SpotInstanceRequest != inst.SpotRequestID {
+		t.Errorf("machine has spot request %q, want %q", d.SpotInstanceRequest, inst.SpotRequestID)
+	}
+	if owner := env.records(t)[inst.ID][machineIdTagKey]; owner != d.Id {
+		t.Errorf("instance is recorded for machine %q, want %q", owner, d.Id)
+	}
+
+	ip, err := d.GetIP()
+	if err != nil || ip != "127.0.0.1" {
+		t.Errorf("got IP %q, %v, want 127.0.0.1", ip, err)
+	}
+	if s, err := env.reload(t, d).GetState(); err != nil || s != state.Running {
+		t.Errorf("got state %v, %v, want Running", s, err)
+	}
+}
+
+func TestCreateRollsBackFailedSpotRequest(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+	env.srv.Script(testGroupID, spotinsttest.SpotRequest{Delay: 1, Fail: true})
+
+	d := env.driver("m1")
+	if err := d.Create(); err == nil {
+		t.Fatal("create succeeded with a failed spot request")
+	}
+
+	g := env.group(t)
+	if g.Target != 0 || len(g.Instances) != 0 {
+		t.Fatalf("group has target %v and %v instances after the rollback, want 0 and 0", g.Target, len(g.Instances))
+	}
+	if d.InstanceId != nil {
+		t.Errorf("machine kept instance %v", *d.InstanceId)
+	}
+}
+
+func TestRemoveDetachesInstance(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	id := *d.InstanceId
+
+	if err := env.reload(t, d).Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	g := env.group(t)
+	if g.Target != 0 || len(g.Instances) != 0 {
+		t.Fatalf("group has target %v and %v instances after remove, want 0 and 0", g.Target, len(g.Instances))
+	}
+	if len(g.Detached) != 1 || g.Detached[0] != id {
+		t.Errorf("detached %v, want [%v]", g.Detached, id)
+	}
+}
+
+func TestGetStateFollowsReplacement(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	replacementID, err := env.srv.Replace(testGroupID, *d.InstanceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := env.reload(t, d)
+	if s, err := loaded.GetState(); err != nil || s != state.Running {
+		t.Fatalf("got state %v, %v, want Running", s, err)
+	}
+	if loaded.InstanceId == nil || *loaded.InstanceId != replacementID {
+		t.Fatalf("machine has instance %v, want the replacement %v", loaded.InstanceId, replacementID)
+	}
+
+	if err := loaded.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	g := env.group(t)
+	if len(g.Detached) != 1 || g.Detached[0] != replacementID {
+		t.Errorf("detached %v, want [%v]", g.Detached, replacementID)
+	}
+}
+
+func TestGetStateWithoutInstance(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	if s, err := env.driver("m1").GetState(); err != nil || s != state.None {
+		t.Fatalf("got state %v, %v before create, want None", s, err)
+	}
+}
+
+func TestStatefulInstanceLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	id, err := env.srv.MakeStateful(testGroupID, *d.InstanceId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateful := func() *spotinsttest.Node {
+		return env.group(t).Stateful[0]
+	}
+
+	d = env.reload(t, d)
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if d.StatefulInstanceId == nil || *d.StatefulInstanceId != id {
+		t.Fatalf("machine has stateful instance %v, want %v", d.StatefulInstanceId, id)
+	}
+	if s, err := d.GetState(); err != nil || s != state.Stopped {
+		t.Fatalf("got state %v, %v after stop, want Stopped", s, err)
+	}
+
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	n := stateful()
+	if n.Instance == nil || *d.InstanceId != n.Instance.ID {
+		t.Fatalf("machine has instance %v after start, want the new instance of the stateful instance", *d.InstanceId)
+	}
+
+	started := *d.InstanceId
+	if err := d.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	n = stateful()
+	if n.Instance == nil || n.Instance.ID == started || *d.InstanceId != n.Instance.ID {
+		t.Fatalf("machine has instance %v after restart, want the recycled instance", *d.InstanceId)
+	}
+	if s, err := d.GetState(); err != nil || s != state.Running {
+		t.Fatalf("got state %v, %v after restart, want Running", s, err)
+	}
+	if *d.PrivateIpAddress != n.Instance.PrivateIP {
+		t.Errorf("machine has IP %v after restart, want %v", *d.PrivateIpAddress, n.Instance.PrivateIP)
+	}
+}
+
+const testGroupTemplate = `
+group:
+  compute:
+    product: Linux/UNIX
+    launchSpecification:
+      imageId: ami-test
+      tags:
+      - tagKey: team
+        tagValue: ci
+      - tagKey: docker-machine-id
+        tagValue: stale
+`
+
+func TestDedicatedGroupLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	template := filepath.Join(env.store, "group.yaml")
+	if err := ioutil.WriteFile(template, []byte(testGroupTemplate), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d := env.driver("m1")
+	d.SpotinstElastiGroupID = ""
+	d.SpotinstGroupTemplate = template
+
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	g := env.srv.Group(d.SpotinstElastiGroupID)
+	if g == nil || g.Name != "m1" || g.Target != 1 || len(g.Instances) != 1 {
+		t.Fatalf("got group %+v, want a group named m1 with one instance", g)
+	}
+	if d.InstanceId == nil || *d.InstanceId != g.Instances[0].ID {
+		t.Fatalf("machine has instance %v, want %v", d.InstanceId, g.Instances[0].ID)
+	}
+	if g.Tags["team"] != "ci" || g.Tags[machineIdTagKey] != d.Id || g.Tags[nameTagKey] != "m1" {
+		t.Errorf("group launches instances tagged %v, want the template and machine tags", formatTags(g.Tags))
+	}
+	if n := env.srv.Calls(spotinsttest.OpScaleUp); n != 0 {
+		t.Errorf("group was scaled up %v times, want 0", n)
+	}
+
+	d = env.reload(t, d)
+	if s, err := d.GetState(); err != nil || s != state.Running {
+		t.Fatalf("got state %v, %v, want Running", s, err)
+	}
+	if err := d.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if env.srv.Group(d.SpotinstElastiGroupID) != nil {
+		t.Error("dedicated group still exists after remove")
+	}
+	if n := env.srv.Calls(spotinsttest.OpDeleteGroup); n != 1 {
+		t.Errorf("group was deleted %v times, want 1", n)
+	}
+}
@@ -0,0 +1,973 @@
+// Package spotinsttest provides a local stand-in for the Spotinst Elastigroup
+// API so the driver can be exercised without the network.
+package spotinsttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+	"github.com/spotinst/spotinst-sdk-go/spotinst/credentials"
+)
+
+const (
+	// Token and Account are the credentials accepted by the server.
+	Token   = "spotinsttest-token"
+	Account = "act-spotinsttest"
+)
+
+// Operation identifies an Elastigroup API operation served by the Server.
+type Operation string
+
+const (
+	OpListGroups  Operation = "list-groups"
+	OpReadGroup   Operation = "read-group"
+	OpCreateGroup Operation = "create-group"
+	OpDeleteGroup Operation = "delete-group"
+
+	OpScaleUp   Operation = "scale-up"
+	OpScaleDown Operation = "scale-down"
+	OpStatus    Operation = "status"
+	OpDetach    Operation = "detach"
+
+	OpListStateful    Operation = "list-stateful"
+	OpPauseStateful   Operation = "pause-stateful"
+	OpResumeStateful  Operation = "resume-stateful"
+	OpRecycleStateful Operation = "recycle-stateful"
+
+	OpCreateNode  Operation = "create-node"
+	OpNodeStatus  Operation = "node-status"
+	OpPauseNode   Operation = "pause-node"
+	OpResumeNode  Operation = "resume-node"
+	OpRecycleNode Operation = "recycle-node"
+	OpDeleteNode  Operation = "delete-node"
+)
+
+// SpotRequest scripts the outcome of one spot request created by a scale up.
+type SpotRequest struct {
+	// Delay is the number of status calls the request stays pending.
+	Delay int
+	// Fail cancels the request instead of fulfilling it.
+	Fail bool
+	// OnDemand returns an instance directly from the scale call.
+	OnDemand bool
+}
+
+// Instance is an instance of a fake group, as reported by the status call.
+type Instance struct {
+	ID            string
+	SpotRequestID string
+	Status        string
+	PrivateIP     string
+	PublicIP      string
+	CreatedAt     time.Time
+
+	delay int
+	fail  bool
+}
+
+// Group is a fake Elastigroup.
+type Group struct {
+	ID     string
+	Name   string
+	Tags   map[string]string
+	Target int
+	// Maximum is the maximum capacity of the group, unlimited when 0.
+	Maximum   int
+	Instances []*Instance
+	Detached  []string
+	// Stateful are the stateful instances of the group, whose instances are
+	// among its Instances while they are active.
+	Stateful []*Node
+}
+
+// Node is a fake stateful node, or a stateful instance of a group. Its
+// Instance is nil while it is paused.
+type Node struct {
+	ID       string
+	Name     string
+	Status   string
+	Instance *Instance
+
+	recycle int
+}
+
+type failure struct {
+	status int
+	times  int
+}
+
+// Server is a local HTTP stand-in for the Elastigroup list, read, create,
+// delete, scale, status and detach endpoints, the stateful instance endpoints
+// of groups, and the stateful node endpoints. Groups are served under the AWS,
+// Azure and GCP paths alike; creating and deleting groups, stateful instances
+// and nodes are AWS only.
+type Server struct {
+	*httptest.Server
+
+	// InstanceIP, when set, is reported as both the private and the public IP
+	// of every instance, e.g. 127.0.0.1 to reach a local SSHServer.
+	InstanceIP string
+
+	mu       sync.Mutex
+	groups   map[string]*Group
+	nodes    map[string]*Node
+	script   map[string][]SpotRequest
+	failures map[Operation]*failure
+	calls    map[Operation]int
+	seq      int
+	clock    time.Time
+}
+
+// NewServer starts a new Server. Callers should call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		groups:   make(map[string]*Group),
+		nodes:    make(map[string]*Node),
+		script:   make(map[string][]SpotRequest),
+		failures: make(map[Operation]*failure),
+		calls:    make(map[Operation]int),
+		clock:    time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Config returns an SDK configuration pointing to the server.
+func (s *Server) Config() *spotinst.Config {
+	config := spotinst.DefaultConfig()
+	config.WithBaseURL(s.URL)
+	config.WithCredentials(credentials.NewStaticCredentials(Token, Account))
+	return config
+}
+
+// AddGroup creates an empty group.
+func (s *Server) AddGroup(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups[id] = &Group{ID: id}
+}
+
+// DescribeGroup sets the name and the instance tags, labels on GCP, the group
+// is listed with.
+func (s *Server) DescribeGroup(id, name string, tags map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g, ok := s.groups[id]; ok {
+		g.Name, g.Tags = name, tags
+	}
+}
+
+// UpdateGroup calls f on the group to change how it is read, e.g. its
+// Maximum.
+func (s *Server) UpdateGroup(id string, f func(g *Group)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g, ok := s.groups[id]; ok {
+		f(g)
+	}
+}
+
+// Group returns a snapshot of the group, or nil if it does not exist.
+func (s *Server) Group(id string) *Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.groups[id]
+	if !ok {
+		return nil
+	}
+	out := *g
+	out.Instances = make([]*Instance, len(g.Instances))
+	for i, inst := range g.Instances {
+		c := *inst
+		out.Instances[i] = &c
+	}
+	out.Detached = append([]string(nil), g.Detached...)
+	out.Stateful = make([]*Node, len(g.Stateful))
+	for i, n := range g.Stateful {
+		c := *n
+		out.Stateful[i] = &c
+	}
+	return &out
+}
+
+// Node returns a snapshot of the stateful node, or nil if it does not exist,
+// e.g. because it was deallocated.
+func (s *Server) Node(id string) *Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.nodes[id]
+	if !ok {
+		return nil
+	}
+	out := *n
+	if n.Instance != nil {
+		inst := *n.Instance
+		out.Instance = &inst
+	}
+	return &out
+}
+
+// Script queues the outcome of the next spot requests created in the group.
+// Scale ups without a scripted request are fulfilled on the next status call.
+func (s *Server) Script(groupID string, requests ...SpotRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script[groupID] = append(s.script[groupID], requests...)
+}
+
+// Fail makes the next times calls to op fail with the given HTTP status.
+func (s *Server) Fail(op Operation, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[op] = &failure{status: status, times: times}
+}
+
+// failed counts a call to op and, if it is scripted to fail, writes the
+// failure. Throttled calls ask to be retried after a second.
+func (s *Server) failed(w http.ResponseWriter, op Operation) bool {
+	s.calls[op]++
+	f := s.failures[op]
+	if f == nil || f.times <= 0 {
+		return false
+	}
+
+	f.times--
+	if f.status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+	}
+	writeError(w, f.status, strconv.Itoa(f.status), "scripted failure")
+	return true
+}
+
+// Calls returns the number of calls made to op.
+func (s *Server) Calls(op Operation) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[op]
+}
+
+// Replace simulates a spot interruption: the instance is terminated and a new
+// running instance is launched in its place. Like Spotinst, the group lists
+// the terminated instance until it is dropped with Drop. It returns the ID of
+// the replacement.
+func (s *Server) Replace(groupID, instanceID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.groups[groupID]
+	if !ok {
+		return "", fmt.Errorf("spotinsttest: no group %v", groupID)
+	}
+	for _, inst := range g.Instances {
+		if inst.ID == instanceID {
+			inst.Status = "terminated"
+			replacement := s.newInstance()
+			replacement.CreatedAt = s.now()
+			g.Instances = append(g.Instances, replacement)
+			return replacement.ID, nil
+		}
+	}
+	return "", fmt.Errorf("spotinsttest: no instance %v in group %v", instanceID, groupID)
+}
+
+// Drop removes an instance from the group, as Spotinst does some time after
+// it terminated.
+func (s *Server) Drop(groupID, instanceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.groups[groupID]
+	if !ok {
+		return fmt.Errorf("spotinsttest: no group %v", groupID)
+	}
+	for i, inst := range g.Instances {
+		if inst.ID == instanceID {
+			g.Instances = append(g.Instances[:i], g.Instances[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("spotinsttest: no instance %v in group %v", instanceID, groupID)
+}
+
+// MakeStateful makes an instance of the group stateful, as if the group had
+// launched it with stateful settings. It returns the ID of the stateful
+// instance.
+func (s *Server) MakeStateful(groupID, instanceID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.groups[groupID]
+	if !ok {
+		return "", fmt.Errorf("spotinsttest: no group %v", groupID)
+	}
+	for _, inst := range g.Instances {
+		if inst.ID == instanceID {
+			s.seq++
+			n := &Node{ID: fmt.Sprintf("ssi-%08x", s.seq), Status: "ACTIVE", Instance: inst}
+			g.Stateful = append(g.Stateful, n)
+			return n.ID, nil
+		}
+	}
+	return "", fmt.Errorf("spotinsttest: no instance %v in group %v", instanceID, groupID)
+}
+
+// now advances the clock of the server by a second, so that instances have
+// distinct creation times.
+func (s *Server) now() time.Time {
+	s.clock = s.clock.Add(time.Second)
+	return s.clock
+}
+
+func (s *Server) newInstance() *Instance {
+	s.seq++
+	inst := &Instance{
+		ID:            fmt.Sprintf("i-%08x", s.seq),
+		SpotRequestID: fmt.Sprintf("sir-%08x", s.seq),
+		Status:        "running",
+		PrivateIP:     fmt.Sprintf("10.0.%d.%d", s.seq/256, s.seq%256),
+		PublicIP:      fmt.Sprintf("54.0.%d.%d", s.seq/256, s.seq%256),
+	}
+	if s.InstanceIP != "" {
+		inst.PrivateIP, inst.PublicIP = s.InstanceIP, s.InstanceIP
+	}
+	return inst
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+Token || r.URL.Query().Get("accountId") != Account {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid credentials")
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/aws/ec2/managedInstance") {
+		s.handleNode(w, r)
+		return
+	}
+
+	// Paths look like /aws/ec2/group/{groupId}/{action...}, with
+	// /compute/azure or /gcp/gce in place of /aws/ec2 for the other clouds.
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 3 && parts[2] == "group" && r.Method == http.MethodGet {
+		s.listGroups(w, cloud(parts[0]+"/"+parts[1]))
+		return
+	}
+	if len(parts) == 3 && parts[2] == "group" && r.Method == http.MethodPost && cloud(parts[0]+"/"+parts[1]) == cloudAWS {
+		s.createGroup(w, r)
+		return
+	}
+	if len(parts) == 4 && parts[2] == "group" && r.Method == http.MethodDelete && cloud(parts[0]+"/"+parts[1]) == cloudAWS {
+		s.deleteGroup(w, parts[3])
+		return
+	}
+	if len(parts) == 4 && parts[2] == "group" && r.Method == http.MethodGet {
+		// Reading the group itself is an empty action.
+		parts = append(parts, "")
+	}
+	if len(parts) < 5 || parts[2] != "group" {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", r.URL.Path)
+		return
+	}
+	c := cloud(parts[0] + "/" + parts[1])
+	groupID, action := parts[3], strings.Join(parts[4:], "/")
+
+	var op Operation
+	switch {
+	case c != cloudAWS && c != cloudAzure && c != cloudGCP:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", r.URL.Path)
+		return
+	case r.Method == http.MethodGet && action == "":
+		op = OpReadGroup
+	case r.Method == http.MethodPut && action == "scale/up":
+		op = OpScaleUp
+	case r.Method == http.MethodPut && action == "scale/down":
+		op = OpScaleDown
+	case r.Method == http.MethodGet && action == "status":
+		op = OpStatus
+	case r.Method == http.MethodPut && action == "detachInstances" && c != cloudAzure:
+		op = OpDetach
+	case r.Method == http.MethodPut && action == "detachNodes" && c == cloudAzure:
+		op = OpDetach
+	case r.Method == http.MethodGet && action == "statefulInstance" && c == cloudAWS:
+		op = OpListStateful
+	case r.Method == http.MethodPut && strings.HasSuffix(action, "/pause") && c == cloudAWS:
+		op = OpPauseStateful
+	case r.Method == http.MethodPut && strings.HasSuffix(action, "/resume") && c == cloudAWS:
+		op = OpResumeStateful
+	case r.Method == http.MethodPut && strings.HasSuffix(action, "/recycle") && c == cloudAWS:
+		op = OpRecycleStateful
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", r.Method+" "+r.URL.Path)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed(w, op) {
+		return
+	}
+
+	g, ok := s.groups[groupID]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "GROUP_DOESNT_EXIST", "Group "+groupID+" does not exist")
+		return
+	}
+
+	switch op {
+	case OpReadGroup:
+		s.readGroup(w, c, g)
+	case OpScaleUp:
+		s.scaleUp(w, r, c, g)
+	case OpScaleDown:
+		s.scaleDown(w, r, g)
+	case OpStatus:
+		s.status(w, c, g)
+	case OpDetach:
+		s.detach(w, r, g)
+	case OpListStateful:
+		s.listStateful(w, g)
+	default:
+		s.changeStateful(w, op, g, parts[4:])
+	}
+}
+
+type cloud string
+
+const (
+	cloudAWS   cloud = "aws/ec2"
+	cloudAzure cloud = "compute/azure"
+	cloudGCP   cloud = "gcp/gce"
+)
+
+func (s *Server) scaleUp(w http.ResponseWriter, r *http.Request, c cloud, g *Group) {
+	adjustment, err := strconv.Atoi(r.URL.Query().Get("adjustment"))
+	if err != nil || adjustment < 1 {
+		writeError(w, http.StatusBadRequest, "INVALID_ADJUSTMENT", "adjustment must be a positive number")
+		return
+	}
+
+	type spotItem struct {
+		SpotInstanceRequestID string `json:"spotInstanceRequestId"`
+	}
+	type instanceItem struct {
+		InstanceID string `json:"instanceId"`
+	}
+	var item struct {
+		NewSpotRequests []spotItem     `json:"newSpotRequests,omitempty"`
+		NewInstances    []instanceItem `json:"newInstances,omitempty"`
+	}
+
+	for i := 0; i < adjustment; i++ {
+		var req SpotRequest
+		if queued := s.script[g.ID]; len(queued) > 0 {
+			req, s.script[g.ID] = queued[0], queued[1:]
+		}
+
+		inst := s.newInstance()
+		g.Target++
+		g.Instances = append(g.Instances, inst)
+
+		if req.OnDemand {
+			inst.SpotRequestID = ""
+			inst.CreatedAt = s.now()
+			item.NewInstances = append(item.NewInstances, instanceItem{InstanceID: inst.ID})
+			continue
+		}
+
+		// The instance stays hidden behind its spot request until fulfilled.
+		inst.delay, inst.fail = req.Delay, req.Fail
+		inst.Status = "pending-evaluation"
+		item.NewSpotRequests = append(item.NewSpotRequests, spotItem{SpotInstanceRequestID: inst.SpotRequestID})
+	}
+
+	// Only AWS reports what a scale up launched.
+	if c != cloudAWS {
+		writeItems(w, "spotinst:"+strings.Replace(string(c), "/", ":", -1)+":group:scale")
+		return
+	}
+	writeItems(w, "spotinst:aws:ec2:group:scale", item)
+}
+
+func (s *Server) scaleDown(w http.ResponseWriter, r *http.Request, g *Group) {
+	adjustment, err := strconv.Atoi(r.URL.Query().Get("adjustment"))
+	if err != nil || adjustment < 1 {
+		writeError(w, http.StatusBadRequest, "INVALID_ADJUSTMENT", "adjustment must be a positive number")
+		return
+	}
+
+	type spotItem struct {
+		SpotInstanceRequestID string `json:"spotInstanceRequestId"`
+	}
+	var item struct {
+		VictimSpotRequests []spotItem `json:"victimSpotRequests,omitempty"`
+	}
+
+	// Like Spotinst, prefer pending spot requests as victims, newest first.
+	for i := len(g.Instances) - 1; i >= 0 && adjustment > 0; i-- {
+		inst := g.Instances[i]
+		if inst.Status != "pending-evaluation" {
+			continue
+		}
+		g.Instances = append(g.Instances[:i], g.Instances[i+1:]...)
+		item.VictimSpotRequests = append(item.VictimSpotRequests, spotItem{SpotInstanceRequestID: inst.SpotRequestID})
+		g.Target--
+		adjustment--
+	}
+
+	g.Target -= adjustment
+	if g.Target < 0 {
+		g.Target = 0
+	}
+	writeItems(w, "spotinst:aws:ec2:group:scale", item)
+}
+
+func (s *Server) status(w http.ResponseWriter, c cloud, g *Group) {
+	type awsInstance struct {
+		ID            *string    `json:"instanceId,omitempty"`
+		SpotRequestID *string    `json:"spotInstanceRequestId,omitempty"`
+		Status        string     `json:"status"`
+		PrivateIP     *string    `json:"privateIp,omitempty"`
+		PublicIP      *string    `json:"publicIp,omitempty"`
+		CreatedAt     *time.Time `json:"createdAt,omitempty"`
+	}
+	type azureNode struct {
+		ID        string    `json:"id"`
+		State     string    `json:"state"`
+		IPAddress string    `json:"ipAddress"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+	type gcpInstance struct {
+		InstanceName string    `json:"instanceName"`
+		StatusName   string    `json:"statusName"`
+		PrivateIP    string    `json:"privateIpAddress"`
+		PublicIP     string    `json:"publicIpAddress"`
+		CreatedAt    time.Time `json:"createdAt"`
+	}
+
+	var items []interface{}
+	var live []*Instance
+	for _, inst := range g.Instances {
+		if inst.Status == "pending-evaluation" {
+			if inst.delay > 0 {
+				inst.delay--
+			} else if inst.fail {
+				// Cancelled spot requests drop out of the group status.
+				continue
+			} else {
+				inst.Status = "running"
+				inst.CreatedAt = s.now()
+			}
+		}
+		live = append(live, inst)
+
+		pending := inst.Status == "pending-evaluation"
+		switch c {
+		case cloudAzure:
+			if !pending {
+				items = append(items, azureNode{inst.ID, inst.Status, inst.PrivateIP, inst.CreatedAt})
+			}
+		case cloudGCP:
+			if !pending {
+				items = append(items, gcpInstance{inst.ID, strings.ToUpper(inst.Status), inst.PrivateIP, inst.PublicIP, inst.CreatedAt})
+			}
+		default:
+			out := awsInstance{Status: inst.Status}
+			if inst.SpotRequestID != "" {
+				out.SpotRequestID = spotinst.String(inst.SpotRequestID)
+			}
+			if !pending {
+				out.ID = spotinst.String(inst.ID)
+				out.PrivateIP = spotinst.String(inst.PrivateIP)
+				out.PublicIP = spotinst.String(inst.PublicIP)
+				createdAt := inst.CreatedAt
+				out.CreatedAt = &createdAt
+			}
+			items = append(items, out)
+		}
+	}
+	g.Instances = live
+
+	writeItems(w, "spotinst:"+strings.Replace(string(c), "/", ":", -1)+":group:status", items...)
+}
+
+func (s *Server) listGroups(w http.ResponseWriter, c cloud) {
+	type label struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	type launchSpecification struct {
+		Tags   []tag   `json:"tags,omitempty"`
+		Labels []label `json:"labels,omitempty"`
+	}
+	type compute struct {
+		LaunchSpecification launchSpecification `json:"launchSpecification"`
+	}
+	type group struct {
+		ID      string   `json:"id"`
+		Name    string   `json:"name"`
+		Compute *compute `json:"compute,omitempty"`
+	}
+
+	if c != cloudAWS && c != cloudAzure && c != cloudGCP {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", string(c))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed(w, OpListGroups) {
+		return
+	}
+
+	ids := make([]string, 0, len(s.groups))
+	for id := range s.groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var items []interface{}
+	for _, id := range ids {
+		g := s.groups[id]
+		item := group{ID: g.ID, Name: g.Name}
+		switch c {
+		case cloudAWS:
+			item.Compute = new(compute)
+			for k, v := range g.Tags {
+				item.Compute.LaunchSpecification.Tags = append(item.Compute.LaunchSpecification.Tags, tag{Key: k, Value: v})
+			}
+		case cloudGCP:
+			item.Compute = new(compute)
+			for k, v := range g.Tags {
+				item.Compute.LaunchSpecification.Labels = append(item.Compute.LaunchSpecification.Labels, label{Key: k, Value: v})
+			}
+		}
+		items = append(items, item)
+	}
+	writeItems(w, "spotinst:"+strings.Replace(string(c), "/", ":", -1)+":group", items...)
+}
+
+// createGroup creates an AWS group from the create request, launching its
+// target capacity at once. The tags of its launch specification become the
+// Tags of the group.
+func (s *Server) createGroup(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Group struct {
+			Name     string `json:"name"`
+			Capacity struct {
+				Target int `json:"target"`
+			} `json:"capacity"`
+			Compute struct {
+				LaunchSpecification struct {
+					Tags []tag `json:"tags"`
+				} `json:"launchSpecification"`
+			} `json:"compute"`
+		} `json:"group"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed(w, OpCreateGroup) {
+		return
+	}
+
+	s.seq++
+	g := &Group{
+		ID:     fmt.Sprintf("sig-%08x", s.seq),
+		Name:   body.Group.Name,
+		Tags:   make(map[string]string),
+		Target: body.Group.Capacity.Target,
+	}
+	for _, t := range body.Group.Compute.LaunchSpecification.Tags {
+		g.Tags[t.Key] = t.Value
+	}
+	for i := 0; i < g.Target; i++ {
+		inst := s.newInstance()
+		inst.CreatedAt = s.now()
+		g.Instances = append(g.Instances, inst)
+	}
+	s.groups[g.ID] = g
+	writeItems(w, "spotinst:aws:ec2:group", map[string]string{"id": g.ID, "name": g.Name})
+}
+
+func (s *Server) deleteGroup(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed(w, OpDeleteGroup) {
+		return
+	}
+	if _, ok := s.groups[id]; !ok {
+		writeError(w, http.StatusBadRequest, "GROUP_DOESNT_EXIST", "Group "+id+" does not exist")
+		return
+	}
+	delete(s.groups, id)
+	writeItems(w, "spotinst:aws:ec2:group")
+}
+
+func (s *Server) readGroup(w http.ResponseWriter, c cloud, g *Group) {
+	type capacity struct {
+		Target  int `json:"target"`
+		Maximum int `json:"maximum,omitempty"`
+	}
+	type group struct {
+		ID       string   `json:"id"`
+		Name     string   `json:"name"`
+		Capacity capacity `json:"capacity"`
+	}
+
+	item := group{ID: g.ID, Name: g.Name, Capacity: capacity{g.Target, g.Maximum}}
+	writeItems(w, "spotinst:"+strings.Replace(string(c), "/", ":", -1)+":group", item)
+}
+
+func (s *Server) detach(w http.ResponseWriter, r *http.Request, g *Group) {
+	var body struct {
+		InstanceIDs                   []string `json:"instancesToDetach"`
+		ShouldDecrementTargetCapacity bool     `json:"shouldDecrementTargetCapacity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+		return
+	}
+
+	for _, id := range body.InstanceIDs {
+		found := false
+		for i, inst := range g.Instances {
+			if inst.ID == id {
+				g.Instances = append(g.Instances[:i], g.Instances[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			writeError(w, http.StatusBadRequest, "INSTANCE_NOT_IN_GROUP", "Instance "+id+" is not in group "+g.ID)
+			return
+		}
+		g.Detached = append(g.Detached, id)
+		if body.ShouldDecrementTargetCapacity && g.Target > 0 {
+			g.Target--
+		}
+	}
+
+	writeItems(w, "spotinst:aws:ec2:group:detach")
+}
+
+func (s *Server) listStateful(w http.ResponseWriter, g *Group) {
+	var items []interface{}
+	for _, n := range g.Stateful {
+		dropped, launched := s.advanceRecycle(n)
+		g.Instances = replaceInstance(g.Instances, dropped, launched)
+		item := map[string]string{"id": n.ID, "state": n.Status}
+		if n.Instance != nil {
+			item["instanceId"] = n.Instance.ID
+			item["privateIp"] = n.Instance.PrivateIP
+		}
+		items = append(items, item)
+	}
+	writeItems(w, "spotinst:aws:ec2:group:statefulInstance", items...)
+}
+
+// changeStateful pauses, resumes or recycles a stateful instance, whose path
+// is /aws/ec2/group/{groupId}/statefulInstance/{statefulInstanceId}/{action}.
+func (s *Server) changeStateful(w http.ResponseWriter, op Operation, g *Group, path []string) {
+	var n *Node
+	for _, v := range g.Stateful {
+		if len(path) == 3 && path[0] == "statefulInstance" && v.ID == path[1] {
+			n = v
+		}
+	}
+	if n == nil {
+		writeError(w, http.StatusBadRequest, "STATEFUL_INSTANCE_DOESNT_EXIST", "Stateful instance does not exist in group "+g.ID)
+		return
+	}
+
+	switch op {
+	case OpPauseStateful:
+		g.Instances = replaceInstance(g.Instances, n.Instance, nil)
+		n.Status, n.Instance = "PAUSED", nil
+	case OpResumeStateful:
+		n.Status, n.Instance = "ACTIVE", s.newInstance()
+		n.Instance.CreatedAt = s.now()
+		g.Instances = replaceInstance(g.Instances, nil, n.Instance)
+	case OpRecycleStateful:
+		n.recycle = recycleSteps
+	}
+	writeItems(w, "spotinst:aws:ec2:group:statefulInstance")
+}
+
+// replaceInstance removes dropped from the instances of a group and adds
+// launched, either of which may be nil.
+func replaceInstance(instances []*Instance, dropped, launched *Instance) []*Instance {
+	for i, inst := range instances {
+		if dropped != nil && inst == dropped {
+			instances = append(instances[:i], instances[i+1:]...)
+			break
+		}
+	}
+	if launched != nil {
+		instances = append(instances, launched)
+	}
+	return instances
+}
+
+// handleNode serves the stateful node endpoints, whose paths look like
+// /aws/ec2/managedInstance/{managedInstanceId}/{action}.
+func (s *Server) handleNode(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var id, action string
+	if len(parts) > 3 {
+		id = parts[3]
+	}
+	if len(parts) > 4 {
+		action = parts[4]
+	}
+
+	var op Operation
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		op = OpCreateNode
+	case r.Method == http.MethodGet && action == "status":
+		op = OpNodeStatus
+	case r.Method == http.MethodPut && action == "pause":
+		op = OpPauseNode
+	case r.Method == http.MethodPut && action == "resume":
+		op = OpResumeNode
+	case r.Method == http.MethodPut && action == "recycle":
+		op = OpRecycleNode
+	case r.Method == http.MethodDelete && id != "" && action == "":
+		op = OpDeleteNode
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", r.Method+" "+r.URL.Path)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failed(w, op) {
+		return
+	}
+
+	if op == OpCreateNode {
+		var body struct {
+			ManagedInstance struct {
+				Name string `json:"name"`
+			} `json:"managedInstance"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+			return
+		}
+		s.seq++
+		n := &Node{
+			ID:     fmt.Sprintf("smi-%08x", s.seq),
+			Name:   body.ManagedInstance.Name,
+			Status: "ACTIVE",
+		}
+		n.Instance = s.newInstance()
+		s.nodes[n.ID] = n
+		writeItems(w, "spotinst:aws:ec2:managedInstance", map[string]string{"id": n.ID, "name": n.Name})
+		return
+	}
+
+	n, ok := s.nodes[id]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "MANAGED_INSTANCE_DOESNT_EXIST", "Managed instance "+id+" does not exist")
+		return
+	}
+
+	switch op {
+	case OpNodeStatus:
+		s.advanceRecycle(n)
+		out := map[string]string{"id": n.ID, "name": n.Name, "status": n.Status}
+		if n.Instance != nil {
+			out["instanceId"] = n.Instance.ID
+			out["privateIp"] = n.Instance.PrivateIP
+			out["publicIp"] = n.Instance.PublicIP
+		}
+		writeItems(w, "spotinst:aws:ec2:managedInstance:status", out)
+		return
+	case OpPauseNode:
+		n.Status, n.Instance = "PAUSED", nil
+	case OpResumeNode:
+		n.Status, n.Instance = "ACTIVE", s.newInstance()
+	case OpRecycleNode:
+		n.recycle = recycleSteps
+	case OpDeleteNode:
+		delete(s.nodes, n.ID)
+	}
+	writeItems(w, "spotinst:aws:ec2:managedInstance")
+}
+
+// recycleSteps is the number of status calls a recycle takes: like Spotinst,
+// the first still reports the old instance as active, the next one the
+// recycle in progress, the last one the new instance.
+const recycleSteps = 3
+
+// advanceRecycle moves a recycle of the node in progress on by one status
+// call. It returns the instance the recycle dropped and the one it launched,
+// if any.
+func (s *Server) advanceRecycle(n *Node) (dropped, launched *Instance) {
+	if n.recycle == 0 {
+		return nil, nil
+	}
+	n.recycle--
+	switch n.recycle {
+	case 1:
+		dropped = n.Instance
+		n.Status, n.Instance = "RECYCLING", nil
+	case 0:
+		launched = s.newInstance()
+		launched.CreatedAt = s.now()
+		n.Status, n.Instance = "ACTIVE", launched
+	}
+	return dropped, launched
+}
+
+type tag struct {
+	Key   string `json:"tagKey"`
+	Value string `json:"tagValue"`
+}
+
+func writeItems(w http.ResponseWriter, kind string, items ...interface{}) {
+	if items == nil {
+		items = []interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"request": map[string]interface{}{"id": "spotinsttest"},
+		"response": map[string]interface{}{
+			"status": map[string]interface{}{"code": http.StatusOK, "message": "OK"},
+			"kind":   kind,
+			"items":  items,
+			"count":  len(items),
+		},
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"request": map[string]interface{}{"id": "spotinsttest"},
+		"response": map[string]interface{}{
+			"status": map[string]interface{}{"code": status, "message": http.StatusText(status)},
+			"errors": []map[string]string{{"code": code, "message": message}},
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package spotinsttest
+
+import (
+	"net"
+)
+
+// SSHServer is a local TCP listener that greets every connection with an SSH
+// identification string, standing in for the sshd of a booted instance.
+type SSHServer struct {
+	listener net.Listener
+}
+
+// NewSSHServer starts a new SSHServer on 127.0.0.1. Callers should call Close
+// when done.
+func NewSSHServer() (*SSHServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-spotinsttest\r\n"))
+			conn.Close()
+		}
+	}()
+
+	return &SSHServer{listener: listener}, nil
+}
+
+// Port returns the port the server listens on.
+func (s *SSHServer) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Close stops the server.
+func (s *SSHServer) Close() error {
+	return s.listener.Close()
+}
@@ -0,0 +1,84 @@
+package spotinst
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+const (
+	sshDialTimeout = 10 * time.Second
+	// Written by cloud-init once all of its boot stages are done.
+	cloudInitBootFinished = "/var/lib/cloud/instance/boot-finished"
+)
+
+// waitForSSH waits until the SSH port of the instance accepts connections and
+// answers with an SSH banner, and optionally until cloud-init is done, so
+// that provisioning does not race the boot of a fresh spot instance.
+func (d *Driver) waitForSSH(ctx context.Context) error {
+	ip, err := d.GetSSHHostname()
+	if err != nil {
+		return err
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+	err = d.waitFor(ctx, "SSH on "+addr, func() (bool, error) {
+		banner, err := readSSHBanner(addr)
+		if err != nil {
+			stdLog(DEBUG, "SSH on %v is not ready: %v", addr, err)
+			return false, nil
+		}
+
+		stdLog(DEBUG, "SSH on %v is ready: %v", addr, banner)
+		return true, nil
+	})
+	if err != nil || !d.WaitForCloudInit {
+		return err
+	}
+
+	return d.waitFor(ctx, "cloud-init to finish", func() (bool, error) {
+		_, err := drivers.RunSSHCommandFromDriver(d, "test -f "+cloudInitBootFinished)
+		if err != nil {
+			stdLog(DEBUG, "cloud-init is not done: %v", err)
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// readSSHBanner connects to addr and returns the SSH identification string
+// the server sends. Servers may send other lines before it (RFC 4253 4.2).
+func readSSHBanner(addr string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, sshDialTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(sshDialTimeout)); err != nil {
+		return "", err
+	}
+
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 10; i++ {
+		line, err := reader.ReadString('\n')
+		if strings.HasPrefix(line, "SSH-") {
+			return strings.TrimSpace(line), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("no SSH banner from %v", addr)
+}
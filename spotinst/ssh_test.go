@@ -0,0 +1,53 @@
+package spotinst
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+)
+
+func TestReadSSHBanner(t *testing.T) {
+	sshd, err := spotinsttest.NewSSHServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sshd.Close()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(sshd.Port()))
+	banner, err := readSSHBanner(addr)
+	if err != nil || banner != "SSH-2.0-spotinsttest" {
+		t.Fatalf("got banner %q, %v, want SSH-2.0-spotinsttest", banner, err)
+	}
+}
+
+func TestCreateTimesOutWaitingForSSH(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	d.SSHPort = closedPort(t)
+	d.CreateTimeout = 2
+	err := d.Create()
+	if err == nil || !strings.Contains(err.Error(), "SSH") {
+		t.Fatalf("got %v, want a timeout waiting for SSH", err)
+	}
+
+	g := env.group(t)
+	if g.Target != 0 || len(g.Instances) != 0 {
+		t.Errorf("group has target %v and %v instances after the rollback, want 0 and 0", g.Target, len(g.Instances))
+	}
+}
+
+// closedPort returns a local port nothing listens on.
+func closedPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
@@ -0,0 +1,88 @@
+package spotinst
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/ssh"
+)
+
+const (
+	sshKeyFile        = "id_rsa"
+	userDataBoundary  = "==SPOTINST-DRIVER-BOUNDARY=="
+	cloudConfigHeader = "#cloud-config"
+)
+
+// ownsSSHKey reports whether the machine uses an SSH key generated by the
+// driver, rather than one given with --spotinst-sshkey-path.
+func (d *Driver) ownsSSHKey() bool {
+	return d.SSHKeyPath == d.ResolveStorePath(sshKeyFile)
+}
+
+// generateSSHKey creates the machine's own SSH key when none was given.
+func (d *Driver) generateSSHKey() error {
+	if d.SSHKeyPath != "" {
+		return nil
+	}
+
+	path := d.ResolveStorePath(sshKeyFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf(tag+"Failed to generate SSH key: %v", err)
+	}
+	if err := ssh.GenerateSSHKey(path); err != nil {
+		return fmt.Errorf(tag+"Failed to generate SSH key: %v", err)
+	}
+
+	stdLog(INFO, "Generated SSH key %v", path)
+	d.SSHKeyPath = path
+	return nil
+}
+
+// injectSSHKey adds the public key of the machine's own SSH key to the base64
+// encoded user data of a launch specification, as cloud-config authorizing it
+// for the default user of the image. Existing user data is kept as a second
+// part of a multipart document, which cloud-init runs as well.
+func (d *Driver) injectSSHKey(userData **string) error {
+	if !d.ownsSSHKey() {
+		return nil
+	}
+
+	publicKey, err := ioutil.ReadFile(d.SSHKeyPath + ".pub")
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to read public SSH key: %v", err)
+	}
+
+	cloudConfig := fmt.Sprintf("%s\nssh_authorized_keys:\n  - %s\n", cloudConfigHeader, strings.TrimSpace(string(publicKey)))
+
+	var existing []byte
+	if *userData != nil && **userData != "" {
+		existing, err = base64.StdEncoding.DecodeString(**userData)
+		if err != nil {
+			return fmt.Errorf(tag+"Failed to decode user data of the template, it must be base64 encoded: %v", err)
+		}
+	}
+
+	result := cloudConfig
+	if len(existing) > 0 {
+		contentType := "text/x-shellscript"
+		if bytes.HasPrefix(existing, []byte(cloudConfigHeader)) {
+			contentType = "text/cloud-config"
+		}
+
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=\"%s\"\nMIME-Version: 1.0\n\n", userDataBoundary)
+		fmt.Fprintf(&b, "--%s\nContent-Type: text/cloud-config; charset=\"us-ascii\"\n\n%s\n", userDataBoundary, cloudConfig)
+		fmt.Fprintf(&b, "--%s\nContent-Type: %s; charset=\"us-ascii\"\n\n%s\n", userDataBoundary, contentType, existing)
+		fmt.Fprintf(&b, "--%s--\n", userDataBoundary)
+		result = b.String()
+	}
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(result))
+	*userData = &encoded
+	return nil
+}
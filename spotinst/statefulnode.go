@@ -0,0 +1,209 @@
+package spotinst
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/machine/libmachine/state"
+	mi "github.com/spotinst/spotinst-sdk-go/service/managedinstance/providers/aws"
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+)
+
+// statefulNodeBackend gets the instance by launching a dedicated Spotinst
+// stateful node, which keeps its volumes and private IP across spot
+// replacements, pauses and resumes.
+type statefulNodeBackend struct {
+	*Driver
+}
+
+func (b statefulNodeBackend) Create(ctx context.Context) error {
+	if _, err := b.restoreCreateProgress(); err != nil {
+		return err
+	}
+
+	if b.StatefulNodeId == nil {
+		node, err := b.loadStatefulNodeTemplate()
+		if err != nil {
+			return err
+		}
+
+		if node.Compute.LaunchSpecification == nil {
+			node.Compute.LaunchSpecification = new(mi.LaunchSpecification)
+		}
+		if err := b.injectSSHKey(&node.Compute.LaunchSpecification.UserData); err != nil {
+			return err
+		}
+		b.tagStatefulNode(node.Compute.LaunchSpecification)
+
+		input := new(mi.CreateManagedInstanceInput)
+		input.ManagedInstance = node
+		output, e := b.getClient().StatefulNodeAWS().Create(context.Background(), input)
+		if e != nil {
+			stdLog(ERROR, "Failed to create stateful node: %v", e)
+			return e
+		}
+
+		if output.ManagedInstance == nil || output.ManagedInstance.ID == nil {
+			err := errors.New(tag + "No stateful node created from template")
+			return err
+		}
+
+		b.StatefulNodeId = output.ManagedInstance.ID
+		stdLog(INFO, "Created stateful node %v", *b.StatefulNodeId)
+
+		if err := b.saveCreateProgress(CreatePhaseNodeCreated); err != nil {
+			return err
+		}
+	}
+
+	err := b.waitFor(ctx, "stateful node "+*b.StatefulNodeId+" IP", func() (bool, error) {
+		if _, err := b.refresh(); err != nil {
+			return false, err
+		}
+		if b.UsePublicIPOnly {
+			return b.PublicIpAddress != nil, nil
+		}
+		return b.PrivateIpAddress != nil, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := b.saveCreateProgress(CreatePhaseRunning); err != nil {
+		return err
+	}
+
+	return b.waitForSSH(ctx)
+}
+
+func (b statefulNodeBackend) State() (state.State, error) {
+	if b.StatefulNodeId == nil {
+		return state.None, nil
+	}
+
+	output, err := b.refresh()
+	if err != nil {
+		return stateError("stateful node "+*b.StatefulNodeId, err)
+	}
+
+	switch spotinst.StringValue(output.Status) {
+	case StatefulInstanceStatePausing, StatefulInstanceStateDeallocating:
+		return state.Stopping, nil
+	case StatefulInstanceStatePaused:
+		return state.Stopped, nil
+	case StatefulInstanceStateResuming, StatefulInstanceStateRecycling:
+		return state.Starting, nil
+	case StatefulInstanceStateDeallocated, StatefulInstanceStateError:
+		return state.Error, fmt.Errorf(tag+"Stateful node %v is %v", *b.StatefulNodeId, spotinst.StringValue(output.Status))
+	case StatefulInstanceStateActive:
+		if output.InstanceID == nil {
+			return state.Starting, nil
+		}
+		return state.Running, nil
+	default:
+		return state.Error, fmt.Errorf(tag+"Unrecognized stateful node state: %v", spotinst.StringValue(output.Status))
+	}
+}
+
+func (b statefulNodeBackend) Start() error {
+	stdLog(INFO, "Resuming stateful node %v", spotinst.StringValue(b.StatefulNodeId))
+	input := new(mi.ResumeManagedInstanceInput)
+	input.ManagedInstanceID = b.StatefulNodeId
+	_, err := b.getClient().StatefulNodeAWS().Resume(context.Background(), input)
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to resume stateful node: %v", toAPIError(err))
+	}
+
+	return b.waitForState(state.Running)
+}
+
+func (b statefulNodeBackend) Stop() error {
+	if err := b.pause(); err != nil {
+		return err
+	}
+
+	return b.waitForState(state.Stopped)
+}
+
+func (b statefulNodeBackend) Restart() error {
+	stdLog(INFO, "Recycling stateful node %v", spotinst.StringValue(b.StatefulNodeId))
+	instanceID := spotinst.StringValue(b.InstanceId)
+	input := new(mi.RecycleManagedInstanceInput)
+	input.ManagedInstanceID = b.StatefulNodeId
+	_, err := b.getClient().StatefulNodeAWS().Recycle(context.Background(), input)
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to recycle stateful node: %v", toAPIError(err))
+	}
+
+	if err := b.waitForRecycle(instanceID); err != nil {
+		return err
+	}
+	return b.waitForState(state.Running)
+}
+
+// Kill pauses the node without waiting for it, keeping its storage.
+func (b statefulNodeBackend) Kill() error {
+	return b.pause()
+}
+
+// Remove deallocates the node, deleting its instance, volumes, snapshots and
+// network interfaces.
+func (b statefulNodeBackend) Remove() error {
+	if _, err := b.restoreCreateProgress(); err != nil {
+		return err
+	}
+
+	if b.StatefulNodeId != nil {
+		input := new(mi.DeleteManagedInstanceInput)
+		input.ManagedInstanceID = b.StatefulNodeId
+		input.DeallocationConfig = &mi.DeallocationConfig{
+			ShouldTerminateInstance:       spotinst.Bool(true),
+			ShouldDeleteVolumes:           spotinst.Bool(true),
+			ShouldDeleteSnapshots:         spotinst.Bool(true),
+			ShouldDeleteNetworkInterfaces: spotinst.Bool(true),
+			ShouldDeleteImages:            spotinst.Bool(true),
+		}
+		_, err := b.getClient().StatefulNodeAWS().Delete(context.Background(), input)
+		if err != nil {
+			return fmt.Errorf(tag+"Failed to deallocate stateful node %v: %v", *b.StatefulNodeId, toAPIError(err))
+		}
+
+		stdLog(INFO, "Deallocated stateful node %v", *b.StatefulNodeId)
+	}
+
+	return b.clearCreateProgress()
+}
+
+// refresh returns the status of the node and updates the instance ID and IPs
+// of the driver, which change when the node is recycled or resumed.
+func (b statefulNodeBackend) refresh() (*mi.StatusManagedInstanceOutput, error) {
+	input := new(mi.StatusManagedInstanceInput)
+	input.ManagedInstanceID = b.StatefulNodeId
+	output, err := b.getClient().StatefulNodeAWS().Status(context.Background(), input)
+	if err != nil {
+		return nil, toAPIError(err)
+	}
+
+	if output.InstanceID != nil {
+		b.InstanceId = output.InstanceID
+	}
+	if output.PrivateIP != nil {
+		b.PrivateIpAddress = output.PrivateIP
+	}
+	if output.PublicIP != nil {
+		b.PublicIpAddress = output.PublicIP
+	}
+	return output, nil
+}
+
+func (b statefulNodeBackend) pause() error {
+	stdLog(INFO, "Pausing stateful node %v", spotinst.StringValue(b.StatefulNodeId))
+	input := new(mi.PauseManagedInstanceInput)
+	input.ManagedInstanceID = b.StatefulNodeId
+	_, err := b.getClient().StatefulNodeAWS().Pause(context.Background(), input)
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to pause stateful node: %v", toAPIError(err))
+	}
+	return nil
+}
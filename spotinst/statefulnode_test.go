@@ -0,0 +1,85 @@
+package spotinst
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+	"github.com/docker/machine/libmachine/state"
+)
+
+const testStatefulNodeTemplate = `
+managedInstance:
+  compute:
+    product: Linux/UNIX
+    launchSpecification:
+      imageId: ami-test
+`
+
+func TestStatefulNodeLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	template := filepath.Join(env.store, "node.yaml")
+	if err := ioutil.WriteFile(template, []byte(testStatefulNodeTemplate), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d := env.driver("m1")
+	d.SpotinstElastiGroupID = ""
+	d.SpotinstBackend = BackendStatefulNode
+	d.SpotinstGroupTemplate = template
+
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if d.StatefulNodeId == nil {
+		t.Fatal("machine has no stateful node")
+	}
+	id := *d.StatefulNodeId
+	n := env.srv.Node(id)
+	if n == nil || n.Name != "m1" || n.Instance == nil {
+		t.Fatalf("got node %+v, want a running node named m1", n)
+	}
+	if d.InstanceId == nil || *d.InstanceId != n.Instance.ID {
+		t.Fatalf("machine has instance %v, want %v", d.InstanceId, n.Instance.ID)
+	}
+
+	d = env.reload(t, d)
+	if err := d.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := d.GetState(); err != nil || s != state.Stopped {
+		t.Fatalf("got state %v, %v after stop, want Stopped", s, err)
+	}
+
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	n = env.srv.Node(id)
+	if n.Instance == nil || *d.InstanceId != n.Instance.ID {
+		t.Fatalf("machine has instance %v after start, want the new instance of the node", d.InstanceId)
+	}
+
+	started := *d.InstanceId
+	if err := d.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	n = env.srv.Node(id)
+	if n.Instance == nil || n.Instance.ID == started || *d.InstanceId != n.Instance.ID {
+		t.Fatalf("machine has instance %v after restart, want the recycled instance of the node", *d.InstanceId)
+	}
+	if s, err := d.GetState(); err != nil || s != state.Running {
+		t.Fatalf("got state %v, %v after restart, want Running", s, err)
+	}
+
+	if err := d.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if env.srv.Node(id) != nil {
+		t.Error("stateful node still exists after remove")
+	}
+	if n := env.srv.Calls(spotinsttest.OpScaleUp); n != 0 {
+		t.Errorf("group was scaled up %v times, want 0", n)
+	}
+}
@@ -0,0 +1,117 @@
+package spotinst
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+const defaultStatusCacheTTL = 5 // seconds
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// statusCacheEntry is a group status saved by statusCachingProvider.
+type statusCacheEntry struct {
+	FetchedAt time.Time   `json:"fetchedAt"`
+	Instances []*instance `json:"instances"`
+}
+
+// statusCachingProvider keeps the status of groups under the docker-machine
+// store for --spotinst-status-cache-ttl seconds, so that the plugin processes
+// of the machines of a group, e.g. during docker-machine ls, share one API
+// call. A file lock makes the processes wait for the one fetching the status
+// rather than fetch it too. Only GetState reads the cache, as the waits of
+// create and remove need the current status; their calls refresh it, and
+// operations that change the group drop it.
+type statusCachingProvider struct {
+	provider
+	driver *Driver
+}
+
+func (p statusCachingProvider) Status(ctx context.Context, groupID string) ([]*instance, error) {
+	path := p.driver.statusCachePath(groupID)
+	ttl := time.Duration(p.driver.StatusCacheTTL) * time.Second
+	if ttl <= 0 || path == "" {
+		return p.provider.Status(ctx, groupID)
+	}
+
+	unlock, err := lockStoreFile(path)
+	if err != nil {
+		stdLog(DEBUG, "Not caching the status of group %v: %v", groupID, err)
+		return p.provider.Status(ctx, groupID)
+	}
+	defer unlock()
+
+	if p.driver.cachedStatusReads {
+		var entry statusCacheEntry
+		if b, err := ioutil.ReadFile(path); err == nil && json.Unmarshal(b, &entry) == nil {
+			if age := time.Since(entry.FetchedAt); age >= 0 && age < ttl {
+				stdLog(DEBUG, "Using the status of group %v cached %v ago", groupID, age.Round(time.Millisecond))
+				return entry.Instances, nil
+			}
+		}
+	}
+
+	instances, err := p.provider.Status(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := statusCacheEntry{FetchedAt: time.Now(), Instances: instances}
+	if b, err := json.Marshal(entry); err == nil {
+		writeFileAtomic(path, b)
+	}
+	return instances, nil
+}
+
+func (p statusCachingProvider) ScaleUp(ctx context.Context, groupID string) (string, string, error) {
+	defer p.driver.dropStatusCache(groupID)
+	return p.provider.ScaleUp(ctx, groupID)
+}
+
+func (p statusCachingProvider) ScaleDown(ctx context.Context, groupID string, adjustment int) error {
+	defer p.driver.dropStatusCache(groupID)
+	return p.provider.ScaleDown(ctx, groupID, adjustment)
+}
+
+func (p statusCachingProvider) Detach(ctx context.Context, groupID string, instanceIDs []string) error {
+	defer p.driver.dropStatusCache(groupID)
+	return p.provider.Detach(ctx, groupID, instanceIDs)
+}
+
+// statusCachePath returns the file the status of the group is cached in, or
+// "" if the machine has no store.
+func (d *Driver) statusCachePath(groupID string) string {
+	return d.groupCachePath(groupID, ".json")
+}
+
+// groupCachePath returns the path of a file about the group shared by the
+// machines of the store, named after its groupKey, or "" if the machine has no
+// store.
+func (d *Driver) groupCachePath(groupID, suffix string) string {
+	if d.StorePath == "" {
+		return ""
+	}
+	name := unsafeFileChars.ReplaceAllString(d.groupKey(groupID), "_")
+	return filepath.Join(d.StorePath, "cache", "spotinst", name+suffix)
+}
+
+// groupKey identifies the group across the machines: group IDs are only
+// unique within an account and cloud provider.
+func (d *Driver) groupKey(groupID string) string {
+	account := d.SpotinstAccount
+	if value, err := d.credentialsChain().Get(); err == nil && value.Account != "" {
+		account = value.Account
+	}
+	return account + "_" + d.cloudProvider() + "_" + groupID
+}
+
+func (d *Driver) dropStatusCache(groupID string) {
+	if path := d.statusCachePath(groupID); path != "" {
+		os.Remove(path)
+	}
+}
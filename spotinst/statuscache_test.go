@@ -0,0 +1,70 @@
+package spotinst
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+	"github.com/docker/machine/libmachine/state"
+)
+
+func TestStatusCacheSharedByStore(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	var machines []*Driver
+	for _, name := range []string{"m1", "m2"} {
+		d := env.driver(name)
+		if err := d.Create(); err != nil {
+			t.Fatal(err)
+		}
+		d = env.reload(t, d)
+		d.StatusCacheTTL = 60
+		machines = append(machines, d)
+	}
+
+	getStates := func() int {
+		before := env.srv.Calls(spotinsttest.OpStatus)
+		for _, d := range machines {
+			if s, err := d.GetState(); err != nil || s != state.Running {
+				t.Fatalf("%v: got state %v, %v, want Running", d.MachineName, s, err)
+			}
+		}
+		return env.srv.Calls(spotinsttest.OpStatus) - before
+	}
+
+	if n := getStates(); n != 1 {
+		t.Fatalf("two machines made %v status calls, want 1", n)
+	}
+	if n := getStates(); n != 0 {
+		t.Fatalf("two machines made %v status calls within the TTL, want 0", n)
+	}
+
+	d := machines[0]
+	p, err := d.provider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range []struct {
+		name string
+		do   func() error
+	}{
+		{"scale up", func() error {
+			_, _, err := p.ScaleUp(context.Background(), testGroupID)
+			return err
+		}},
+		{"scale down", func() error { return p.ScaleDown(context.Background(), testGroupID, 1) }},
+		{"detach", func() error { return p.Detach(context.Background(), testGroupID, []string{*machines[1].InstanceId}) }},
+	} {
+		if err := change.do(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(d.statusCachePath(testGroupID)); !os.IsNotExist(err) {
+			t.Fatalf("status cache was kept after %v: %v", change.name, err)
+		}
+		if _, err := d.GetState(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package spotinst
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// lockStoreFile takes the lock of a file shared by the machines of the store,
+// at path+".lock", creating its directory first. It returns the function
+// releasing the lock.
+func lockStoreFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return lockFile(path + ".lock")
+}
+
+// writeFileAtomic writes a file readable by the user only. It writes to a
+// temporary file first so a crash never leaves a truncated file.
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,168 @@
+package spotinst
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/spotinst/spotinst-sdk-go/service/elastigroup/providers/aws"
+	mi "github.com/spotinst/spotinst-sdk-go/service/managedinstance/providers/aws"
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+)
+
+const (
+	// machineIdTagKey is the tag holding the Driver.Id of the machine. It
+	// tells which machine owns the instance, and finds the instance that
+	// replaces an interrupted spot instance.
+	machineIdTagKey = "docker-machine-id"
+
+	nameTagKey      = "Name"
+	creatorTagKey   = "docker-machine-creator"
+	createdAtTagKey = "docker-machine-created-at"
+
+	// reservedTagPrefix is the prefix of the tags set by the driver, which
+	// --spotinst-tag cannot set.
+	reservedTagPrefix = "docker-machine-"
+)
+
+// parseInstanceTags parses the --spotinst-tag tags, which cannot set the tags
+// of the driver.
+func parseInstanceTags(pairs []string) (map[string]string, error) {
+	tags, err := parseTags(pairs)
+	if err != nil {
+		return nil, err
+	}
+	for k := range tags {
+		if strings.HasPrefix(k, reservedTagPrefix) {
+			return nil, fmt.Errorf(tag+"Tag %v is reserved, %v* tags are set by the driver", k, reservedTagPrefix)
+		}
+	}
+	return tags, nil
+}
+
+// machineTags returns the tags of the machine's instance: the --spotinst-tag
+// tags, then its name, unless given as a tag, its ID, creator, creation time
+// and expiry, if any.
+func (d *Driver) machineTags() map[string]string {
+	tags := make(map[string]string, len(d.SpotinstTags)+4)
+	for k, v := range d.SpotinstTags {
+		tags[k] = v
+	}
+	if _, ok := tags[nameTagKey]; !ok && d.MachineName != "" {
+		tags[nameTagKey] = d.MachineName
+	}
+	tags[machineIdTagKey] = d.Id
+	tags[creatorTagKey] = creator()
+	tags[createdAtTagKey] = time.Now().UTC().Format(time.RFC3339)
+	if !d.ExpiresAt.IsZero() {
+		tags[expiresAtTagKey] = d.ExpiresAt.Format(time.RFC3339)
+	}
+	return tags
+}
+
+// creator returns the user running docker-machine, as user@host.
+func creator() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		return name + "@" + host
+	}
+	return name
+}
+
+// recordInstance records the machine tags for the instance of the machine.
+func (d *Driver) recordInstance() error {
+	return d.recordInstanceID(*d.InstanceId)
+}
+
+// recordInstanceID records the machine tags for the given instance of the
+// group, see instanceRecords. The creation time of an instance recorded before
+// is kept.
+func (d *Driver) recordInstanceID(instanceID string) error {
+	tags := d.machineTags()
+	err := d.updateInstanceRecords(d.SpotinstElastiGroupID, func(records map[string]map[string]string) error {
+		// A resumed create records the instance again.
+		if created := records[instanceID][createdAtTagKey]; created != "" {
+			tags[createdAtTagKey] = created
+		}
+		setRecord(records, instanceID, tags)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to record instance %v: %v", instanceID, strings.TrimPrefix(err.Error(), tag))
+	}
+
+	stdLog(DEBUG, "Recorded instance %v with %v", instanceID, formatTags(tags))
+	return nil
+}
+
+// tagStatefulNode adds the machine tags to the launch specification of a
+// stateful node. The tags of its template win, except the driver's own.
+func (d *Driver) tagStatefulNode(spec *mi.LaunchSpecification) {
+	tags := d.machineTags()
+
+	var kept []*mi.Tag
+	for _, t := range spec.Tags {
+		k := spotinst.StringValue(t.Key)
+		if strings.HasPrefix(k, reservedTagPrefix) {
+			continue
+		}
+		delete(tags, k)
+		kept = append(kept, t)
+	}
+	for _, k := range sortedKeys(tags) {
+		kept = append(kept, &mi.Tag{Key: spotinst.String(k), Value: spotinst.String(tags[k])})
+	}
+	spec.Tags = kept
+}
+
+// tagGroupTemplate adds the machine tags to the launch specification of a
+// dedicated group, so that its instances carry them. The tags of its template
+// win, except the driver's own.
+func (d *Driver) tagGroupTemplate(spec *aws.LaunchSpecification) {
+	tags := d.machineTags()
+
+	var kept []*aws.Tag
+	for _, t := range spec.Tags {
+		k := spotinst.StringValue(t.Key)
+		if strings.HasPrefix(k, reservedTagPrefix) {
+			continue
+		}
+		delete(tags, k)
+		kept = append(kept, t)
+	}
+	for _, k := range sortedKeys(tags) {
+		kept = append(kept, &aws.Tag{Key: spotinst.String(k), Value: spotinst.String(tags[k])})
+	}
+	spec.Tags = kept
+}
+
+// checkOwnership refuses to detach an instance that the records of the store
+// give to another machine, e.g. because the store of this machine was copied.
+// Instances without a record, launched by older versions of the driver or
+// whose recording failed, are left to the caller. So is an instance whose
+// records cannot be read: only a known owner blocks the removal.
+func (d *Driver) checkOwnership() error {
+	records, err := d.instanceRecords(d.SpotinstElastiGroupID)
+	if err != nil {
+		stdLog(WARN, "Cannot check the owner of instance %v, detaching it anyway: %v", *d.InstanceId, err)
+		return nil
+	}
+
+	if owner := records[*d.InstanceId][machineIdTagKey]; owner != "" && owner != d.Id {
+		return fmt.Errorf(tag+"Instance %v belongs to machine %v, not to %v (%v), refusing to detach it", *d.InstanceId, owner, d.MachineName, d.Id)
+	}
+	return nil
+}
+
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for _, k := range sortedKeys(tags) {
+		pairs = append(pairs, k+"="+tags[k])
+	}
+	return strings.Join(pairs, " ")
+}
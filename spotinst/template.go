@@ -0,0 +1,163 @@
+package spotinst
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"text/template"
+
+	"github.com/spotinst/spotinst-sdk-go/service/elastigroup/providers/aws"
+	mi "github.com/spotinst/spotinst-sdk-go/service/managedinstance/providers/aws"
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+	"gopkg.in/yaml.v2"
+)
+
+// templateData holds the values available to placeholders in a group template,
+// e.g. {{.MachineName}}.
+type templateData struct {
+	MachineName string
+	MachineId   string
+	SSHUser     string
+}
+
+// loadGroupTemplate renders the group template file of the driver and decodes
+// it into an Elastigroup. Both JSON and YAML files are accepted, either as the
+// bare group or wrapped in a "group" key as exported by the Spotinst console.
+func (d *Driver) loadGroupTemplate() (*aws.Group, error) {
+	body, err := d.renderTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	var wrapper struct {
+		Group *aws.Group `json:"group"`
+	}
+	if err := json.Unmarshal(body, &wrapper); err != nil {
+		return nil, fmt.Errorf(tag+"Failed to decode group template: %v", err)
+	}
+
+	group := wrapper.Group
+	if group == nil {
+		group = new(aws.Group)
+		if err := json.Unmarshal(body, group); err != nil {
+			return nil, fmt.Errorf(tag+"Failed to decode group template: %v", err)
+		}
+	}
+
+	if group.Compute == nil {
+		return nil, fmt.Errorf(tag+"Group template %v has no compute section", d.SpotinstGroupTemplate)
+	}
+
+	// A dedicated group always holds exactly one instance, the machine.
+	group.ID = nil
+	if group.Name == nil {
+		group.Name = spotinst.String(d.MachineName)
+	}
+	group.Capacity = &aws.Capacity{
+		Minimum: spotinst.Int(1),
+		Maximum: spotinst.Int(1),
+		Target:  spotinst.Int(1),
+	}
+
+	return group, nil
+}
+
+// loadStatefulNodeTemplate renders the template file of the driver and
+// decodes it into a stateful node, either bare or wrapped in a
+// "managedInstance" key. The node always persists its root volume, data
+// volumes and private IP.
+func (d *Driver) loadStatefulNodeTemplate() (*mi.ManagedInstance, error) {
+	body, err := d.renderTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	var wrapper struct {
+		ManagedInstance *mi.ManagedInstance `json:"managedInstance"`
+	}
+	if err := json.Unmarshal(body, &wrapper); err != nil {
+		return nil, fmt.Errorf(tag+"Failed to decode stateful node template: %v", err)
+	}
+
+	node := wrapper.ManagedInstance
+	if node == nil {
+		node = new(mi.ManagedInstance)
+		if err := json.Unmarshal(body, node); err != nil {
+			return nil, fmt.Errorf(tag+"Failed to decode stateful node template: %v", err)
+		}
+	}
+
+	if node.Compute == nil {
+		return nil, fmt.Errorf(tag+"Stateful node template %v has no compute section", d.SpotinstGroupTemplate)
+	}
+
+	node.ID = nil
+	if node.Name == nil {
+		node.Name = spotinst.String(d.MachineName)
+	}
+	node.Persistence = &mi.Persistence{
+		PersistRootDevice:   spotinst.Bool(true),
+		PersistBlockDevices: spotinst.Bool(true),
+		PersistPrivateIP:    spotinst.Bool(true),
+		BlockDevicesMode:    spotinst.String("reattach"),
+	}
+
+	return node, nil
+}
+
+// renderTemplate renders the template file of the driver and returns it as
+// JSON. YAML is a superset of JSON, so a single decoder handles both formats.
+func (d *Driver) renderTemplate() ([]byte, error) {
+	raw, err := ioutil.ReadFile(d.SpotinstGroupTemplate)
+	if err != nil {
+		return nil, fmt.Errorf(tag+"Failed to read template: %v", err)
+	}
+
+	tmpl, err := template.New(filepath.Base(d.SpotinstGroupTemplate)).Option("missingkey=error").Parse(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf(tag+"Failed to parse template: %v", err)
+	}
+
+	var rendered bytes.Buffer
+	data := templateData{
+		MachineName: d.MachineName,
+		MachineId:   d.Id,
+		SSHUser:     d.GetSSHUsername(),
+	}
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return nil, fmt.Errorf(tag+"Failed to render template: %v", err)
+	}
+
+	var doc interface{}
+	if err := yaml.Unmarshal(rendered.Bytes(), &doc); err != nil {
+		return nil, fmt.Errorf(tag+"Failed to decode template: %v", err)
+	}
+
+	body, err := json.Marshal(jsonCompatible(doc))
+	if err != nil {
+		return nil, fmt.Errorf(tag+"Failed to decode template: %v", err)
+	}
+	return body, nil
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values produced by
+// the YAML decoder into map[string]interface{} so they can be marshaled as JSON.
+func jsonCompatible(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = jsonCompatible(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range t {
+			t[i] = jsonCompatible(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
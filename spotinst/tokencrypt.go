@@ -0,0 +1,147 @@
+package spotinst
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spotinst/spotinst-sdk-go/spotinst/credentials"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// encryptedTokenPrefix marks a Driver.SpotinstToken saved encrypted, as
+	// the base64 encoding of a salt, a nonce and the AES-256-GCM sealed token.
+	encryptedTokenPrefix = "encrypted:v1:"
+
+	// tokenPassphraseEnvVar holds the passphrase the token is encrypted with
+	// when no key file is given. It is never saved with the machine.
+	tokenPassphraseEnvVar = "SPOTINST_TOKEN_PASSPHRASE"
+
+	tokenSaltSize      = 16
+	tokenKeyIterations = 100000
+	tokenKeySize       = 32
+	tokenProviderName  = "DriverTokenProvider"
+)
+
+// tokenSecret returns the secret the token is encrypted with: the content of
+// the key file, or else the passphrase environment variable. It returns an
+// empty secret if neither is set.
+func (d *Driver) tokenSecret() ([]byte, error) {
+	if d.SpotinstTokenKeyFile != "" {
+		b, err := ioutil.ReadFile(d.SpotinstTokenKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf(tag+"Failed to read the token key file: %v", err)
+		}
+		b = bytes.TrimSpace(b)
+		if len(b) == 0 {
+			return nil, fmt.Errorf(tag+"Token key file %v is empty", d.SpotinstTokenKeyFile)
+		}
+		return b, nil
+	}
+	return []byte(os.Getenv(tokenPassphraseEnvVar)), nil
+}
+
+// encryptToken encrypts the token in place when a key file or passphrase is
+// set, so that it is saved encrypted with the machine.
+func (d *Driver) encryptToken() error {
+	if d.SpotinstToken == "" || strings.HasPrefix(d.SpotinstToken, encryptedTokenPrefix) {
+		return nil
+	}
+
+	secret, err := d.tokenSecret()
+	if err != nil || len(secret) == 0 {
+		return err
+	}
+
+	blob := make([]byte, tokenSaltSize, tokenSaltSize+12+len(d.SpotinstToken)+16)
+	if _, err := io.ReadFull(rand.Reader, blob); err != nil {
+		return fmt.Errorf(tag+"Failed to encrypt the token: %v", err)
+	}
+	gcm, err := tokenCipher(secret, blob[:tokenSaltSize])
+	if err != nil {
+		return fmt.Errorf(tag+"Failed to encrypt the token: %v", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf(tag+"Failed to encrypt the token: %v", err)
+	}
+	blob = append(blob, nonce...)
+	blob = gcm.Seal(blob, nonce, []byte(d.SpotinstToken), nil)
+
+	d.SpotinstToken = encryptedTokenPrefix + base64.StdEncoding.EncodeToString(blob)
+	return nil
+}
+
+// decryptToken returns the token, decrypting it if it was saved encrypted.
+func (d *Driver) decryptToken() (string, error) {
+	if !strings.HasPrefix(d.SpotinstToken, encryptedTokenPrefix) {
+		return d.SpotinstToken, nil
+	}
+
+	secret, err := d.tokenSecret()
+	if err != nil {
+		return "", err
+	}
+	if len(secret) == 0 {
+		return "", errors.New(tag + "The Spotinst token of the machine is encrypted, set " + tokenPassphraseEnvVar + " or --spotinst-token-key-file to decrypt it")
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(d.SpotinstToken, encryptedTokenPrefix))
+	if err != nil || len(blob) < tokenSaltSize {
+		return "", errors.New(tag + "The encrypted Spotinst token of the machine is corrupt")
+	}
+	gcm, err := tokenCipher(secret, blob[:tokenSaltSize])
+	if err != nil {
+		return "", fmt.Errorf(tag+"Failed to decrypt the token: %v", err)
+	}
+	blob = blob[tokenSaltSize:]
+	if len(blob) < gcm.NonceSize() {
+		return "", errors.New(tag + "The encrypted Spotinst token of the machine is corrupt")
+	}
+	token, err := gcm.Open(nil, blob[:gcm.NonceSize()], blob[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New(tag + "Failed to decrypt the Spotinst token, the key file or passphrase is wrong")
+	}
+	return string(token), nil
+}
+
+func tokenCipher(secret, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key(secret, salt, tokenKeyIterations, tokenKeySize, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// tokenProvider provides the token and account flags, decrypting the token if
+// it was saved encrypted.
+type tokenProvider struct {
+	driver *Driver
+}
+
+func (p *tokenProvider) Retrieve() (credentials.Value, error) {
+	token, err := p.driver.decryptToken()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	static := &credentials.StaticProvider{
+		Value: credentials.Value{
+			Token:        token,
+			Account:      p.driver.SpotinstAccount,
+			ProviderName: tokenProviderName,
+		},
+	}
+	return static.Retrieve()
+}
+
+func (p *tokenProvider) String() string { return tokenProviderName }
@@ -0,0 +1,146 @@
+package spotinst
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+	"github.com/docker/machine/libmachine/state"
+)
+
+// keyFile writes a token key file to dir.
+func keyFile(t *testing.T, dir, name, key string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(key+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// encryptedDriver returns a driver whose token is encrypted with the key file.
+func encryptedDriver(t *testing.T, keyFile string) *Driver {
+	d := NewDriver("m1", "")
+	d.SpotinstToken = "secret-token"
+	d.SpotinstTokenKeyFile = keyFile
+	if err := d.encryptToken(); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestTokenEncryptionRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spotinst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := encryptedDriver(t, keyFile(t, dir, "key", "k1"))
+	if !strings.HasPrefix(d.SpotinstToken, encryptedTokenPrefix) || strings.Contains(d.SpotinstToken, "secret-token") {
+		t.Fatalf("token saved as %q, want it encrypted", d.SpotinstToken)
+	}
+
+	encrypted := d.SpotinstToken
+	if err := d.encryptToken(); err != nil || d.SpotinstToken != encrypted {
+		t.Fatalf("encrypting again changed the token to %q, %v", d.SpotinstToken, err)
+	}
+
+	token, err := d.decryptToken()
+	if err != nil || token != "secret-token" {
+		t.Fatalf("got token %q, %v, want secret-token", token, err)
+	}
+}
+
+func TestTokenDecryptionWithWrongKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spotinst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := encryptedDriver(t, keyFile(t, dir, "key", "k1"))
+	d.SpotinstTokenKeyFile = keyFile(t, dir, "other", "k2")
+
+	if _, err := d.decryptToken(); err == nil || !strings.Contains(err.Error(), "key file or passphrase is wrong") {
+		t.Fatalf("got %v, want a wrong key error", err)
+	}
+}
+
+func TestTokenDecryptionWithoutPassphrase(t *testing.T) {
+	defer os.Unsetenv(tokenPassphraseEnvVar)
+	os.Setenv(tokenPassphraseEnvVar, "passphrase")
+
+	d := encryptedDriver(t, "")
+	if token, err := d.decryptToken(); err != nil || token != "secret-token" {
+		t.Fatalf("got token %q, %v with the passphrase, want secret-token", token, err)
+	}
+
+	os.Unsetenv(tokenPassphraseEnvVar)
+	_, err := d.decryptToken()
+	if err == nil || !strings.Contains(err.Error(), tokenPassphraseEnvVar) || !strings.Contains(err.Error(), "--spotinst-token-key-file") {
+		t.Fatalf("got %v, want an error naming %v and --spotinst-token-key-file", err, tokenPassphraseEnvVar)
+	}
+}
+
+func TestTokenDecryptionOfCorruptBlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spotinst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := encryptedDriver(t, keyFile(t, dir, "key", "k1"))
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(d.SpotinstToken, encryptedTokenPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := append([]byte(nil), blob...)
+	flipped[len(flipped)-1] ^= 1
+
+	for _, tt := range []struct {
+		name, token, err string
+	}{
+		{"not base64", encryptedTokenPrefix + "!!!", "is corrupt"},
+		{"truncated salt", encryptedTokenPrefix + base64.StdEncoding.EncodeToString(blob[:tokenSaltSize-1]), "is corrupt"},
+		{"truncated nonce", encryptedTokenPrefix + base64.StdEncoding.EncodeToString(blob[:tokenSaltSize+4]), "is corrupt"},
+		{"altered", encryptedTokenPrefix + base64.StdEncoding.EncodeToString(flipped), "Failed to decrypt"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d.SpotinstToken = tt.token
+			if _, err := d.decryptToken(); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEncryptedTokenSurvivesReload(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	d.SpotinstTokenKeyFile = keyFile(t, env.store, "key", "k1")
+	if err := d.encryptToken(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), spotinsttest.Token) {
+		t.Fatal("saved machine holds the token in plain text")
+	}
+
+	if s, err := env.reload(t, d).GetState(); err != nil || s != state.Running {
+		t.Fatalf("got state %v, %v after reload, want Running", s, err)
+	}
+}
@@ -0,0 +1,122 @@
+package spotinst
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultCreateTimeout     = 600 // seconds
+	defaultPollInterval      = 10  // seconds
+	defaultPollMaxInterval   = 60  // seconds
+	defaultPollBackoffFactor = 1.5
+	pollJitter               = 0.2
+)
+
+var (
+	interruptCtx, interrupt = context.WithCancel(context.Background())
+)
+
+// CancelOnSignals makes the driver give up its waits when the plugin process
+// receives SIGINT or SIGTERM, so that an interrupted Create rolls back instead
+// of leaving capacity behind. A second signal exits immediately.
+func CancelOnSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		stdLog(WARN, "Received %v, cancelling", sig)
+		interrupt()
+		<-signals
+		os.Exit(1)
+	}()
+}
+
+// createContext returns the context bounding Create and the other operations
+// that wait for the instance to reach a state.
+func (d *Driver) createContext() (context.Context, context.CancelFunc) {
+	timeout := d.CreateTimeout
+	if timeout <= 0 {
+		timeout = defaultCreateTimeout
+	}
+	return context.WithTimeout(interruptCtx, time.Duration(timeout)*time.Second)
+}
+
+// waitFor calls check until it reports done or fails. Between calls it sleeps
+// for the poll interval, which grows by the backoff factor up to the maximum
+// interval and is randomized by a jitter. It gives up when ctx is done, either
+// because its timeout elapsed or because the plugin was interrupted.
+func (d *Driver) waitFor(ctx context.Context, what string, check func() (bool, error)) error {
+	interval := d.pollInterval()
+	for {
+		done, err := check()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		wait := withJitter(interval)
+		stdLog(DEBUG, "Waiting for %v, next check in %v", what, wait.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf(tag+"Wait for %v reached timeout", what)
+			}
+			return fmt.Errorf(tag+"Wait for %v was interrupted", what)
+		case <-time.After(wait):
+		}
+
+		interval = d.nextPollInterval(interval)
+	}
+}
+
+func (d *Driver) pollInterval() time.Duration {
+	if d.PollInterval <= 0 {
+		return defaultPollInterval * time.Second
+	}
+	return time.Duration(d.PollInterval) * time.Second
+}
+
+func (d *Driver) nextPollInterval(interval time.Duration) time.Duration {
+	factor := d.PollBackoffFactor
+	if factor < 1 {
+		factor = defaultPollBackoffFactor
+	}
+	max := time.Duration(d.PollMaxInterval) * time.Second
+	if max <= 0 {
+		max = defaultPollMaxInterval * time.Second
+	}
+
+	next := time.Duration(float64(interval) * factor)
+	if next > max {
+		next = max
+	}
+	if next < interval {
+		next = interval
+	}
+	return next
+}
+
+func withJitter(interval time.Duration) time.Duration {
+	delta := (rand.Float64()*2 - 1) * pollJitter * float64(interval)
+	return interval + time.Duration(delta)
+}
+
+func parseBackoffFactor(value string) (float64, error) {
+	if value == "" {
+		return defaultPollBackoffFactor, nil
+	}
+	factor, err := strconv.ParseFloat(value, 64)
+	if err != nil || factor < 1 {
+		return 0, fmt.Errorf(tag+"Invalid poll backoff factor %q, must be a number >= 1", value)
+	}
+	return factor, nil
+}
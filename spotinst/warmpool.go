@@ -0,0 +1,152 @@
+package spotinst
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/spotinst/spotinst-sdk-go/spotinst"
+)
+
+const (
+	// poolTagKey marks the instances of the warm pool of a group in the
+	// records of the store: unclaimed while they wait for a machine, claimed
+	// once one took them.
+	poolTagKey    = "docker-machine-pool"
+	poolUnclaimed = "unclaimed"
+	poolClaimed   = "claimed"
+)
+
+// checkWarmPool checks that the warm pool can be used: refilling it resolves
+// each scale up through its spot request, which only AWS Elastigroups name.
+func (d *Driver) checkWarmPool() error {
+	if d.cloudProvider() != CloudProviderAWS || d.SpotinstBackend != BackendElastigroup || d.SpotinstGroupTemplate != "" {
+		return errors.New(tag + "The warm pool is only supported for shared AWS Elastigroups")
+	}
+	return nil
+}
+
+// poolInstances returns the live instances whose pool record is value, oldest
+// first.
+func poolInstances(instances []*instance, records map[string]map[string]string, value string) []*instance {
+	var out []*instance
+	for _, inst := range instances {
+		if !inst.Gone && records[inst.ID][poolTagKey] == value {
+			out = append(out, inst)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// claimPoolInstance takes the oldest running instance of the warm pool of the
+// group for the machine, recording it with the machine ID. It returns false if
+// the pool has no instance left to claim. The claim is made under the lock of
+// the records, so it is only atomic among the machines of one store.
+func (d *Driver) claimPoolInstance() (bool, error) {
+	instances, err := d.groupStatus()
+	if err != nil {
+		return false, err
+	}
+
+	var claimed *instance
+	err = d.updateInstanceRecords(d.SpotinstElastiGroupID, func(records map[string]map[string]string) error {
+		for _, inst := range poolInstances(instances, records, poolUnclaimed) {
+			if inst.State == state.Running {
+				setRecord(records, inst.ID, map[string]string{poolTagKey: poolClaimed, machineIdTagKey: d.Id})
+				claimed = inst
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if claimed == nil {
+		stdLog(INFO, "Warm pool of group %v is empty, scaling up", d.SpotinstElastiGroupID)
+		return false, nil
+	}
+
+	stdLog(INFO, "Claimed warm pool instance %v of group %v", claimed.ID, d.SpotinstElastiGroupID)
+	d.InstanceId = spotinst.String(claimed.ID)
+	if claimed.PrivateIP != "" {
+		d.PrivateIpAddress = spotinst.String(claimed.PrivateIP)
+	}
+	if claimed.PublicIP != "" {
+		d.PublicIpAddress = spotinst.String(claimed.PublicIP)
+	}
+	return true, d.saveCreateProgress(CreatePhaseInstanceAssigned)
+}
+
+// refillPool scales the group up until its warm pool has size live instances,
+// recording each new instance as unclaimed once its spot request is fulfilled.
+func (d *Driver) refillPool(ctx context.Context, size int) error {
+	instances, err := d.groupStatus()
+	if err != nil {
+		return err
+	}
+	records, err := d.instanceRecords(d.SpotinstElastiGroupID)
+	if err != nil {
+		return err
+	}
+	pool := poolInstances(instances, records, poolUnclaimed)
+	missing := size - len(pool)
+	if missing <= 0 {
+		stdLog(INFO, "Warm pool of group %v has %v instances, nothing to do", d.SpotinstElastiGroupID, len(pool))
+		return nil
+	}
+
+	p, err := d.provider()
+	if err != nil {
+		return err
+	}
+
+	// Scale up for all the missing instances first, so that their spot
+	// requests are fulfilled in parallel.
+	var instanceIDs, requestIDs []string
+	for i := 0; i < missing; i++ {
+		instanceID, requestID, err := p.ScaleUp(ctx, d.SpotinstElastiGroupID)
+		if err != nil {
+			return fmt.Errorf(tag+"Failed to scale up group %v: %v", d.SpotinstElastiGroupID, err)
+		}
+		if instanceID != "" {
+			instanceIDs = append(instanceIDs, instanceID)
+		} else {
+			requestIDs = append(requestIDs, requestID)
+		}
+	}
+	stdLog(INFO, "Scaled up group %v by %v for its warm pool", d.SpotinstElastiGroupID, missing)
+
+	var failed []string
+	for _, requestID := range requestIDs {
+		d.InstanceId = nil
+		if err := d.waitForInstanceSpot(ctx, spotinst.String(requestID)); err != nil {
+			failed = append(failed, fmt.Sprintf("spot request %v: %v", requestID, strings.TrimPrefix(err.Error(), tag)))
+			continue
+		}
+		instanceIDs = append(instanceIDs, *d.InstanceId)
+	}
+	d.InstanceId = nil
+
+	err = d.updateInstanceRecords(d.SpotinstElastiGroupID, func(records map[string]map[string]string) error {
+		for _, id := range instanceIDs {
+			setRecord(records, id, map[string]string{poolTagKey: poolUnclaimed})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, id := range instanceIDs {
+		stdLog(INFO, "Added instance %v to the warm pool of group %v", id, d.SpotinstElastiGroupID)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf(tag+"Failed to add %v instances to the warm pool:\n  - %v", len(failed), strings.Join(failed, "\n  - "))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package spotinst
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker-machine-driver-spotinst/spotinst/spotinsttest"
+)
+
+// refill fills the warm pool of the test group up to size instances.
+func (e *testEnv) refill(t *testing.T, size int) {
+	if err := e.driver("").refillPool(context.Background(), size); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pool returns the IDs of the instances recorded in the warm pool as value.
+func (e *testEnv) pool(t *testing.T, value string) []string {
+	var ids []string
+	for _, inst := range e.group(t).Instances {
+		if e.records(t)[inst.ID][poolTagKey] == value {
+			ids = append(ids, inst.ID)
+		}
+	}
+	return ids
+}
+
+func TestWarmPoolEmptyScalesUp(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	d := env.driver("m1")
+	d.SpotinstWarmPool = true
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if n := env.srv.Calls(spotinsttest.OpScaleUp); n != 1 {
+		t.Errorf("group was scaled up %v times, want 1", n)
+	}
+	if owner := env.records(t)[*d.InstanceId][machineIdTagKey]; owner != d.Id {
+		t.Errorf("instance is recorded for machine %q, want %q", owner, d.Id)
+	}
+}
+
+func TestWarmPoolSkipsClaimedInstance(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	env.refill(t, 2)
+	unclaimed := env.pool(t, poolUnclaimed)
+	if len(unclaimed) != 2 {
+		t.Fatalf("warm pool has %v, want 2 instances", unclaimed)
+	}
+
+	// Another machine claimed the oldest instance since it was listed.
+	taken, free := unclaimed[0], unclaimed[1]
+	err := env.driver("other").updateInstanceRecords(testGroupID, func(records map[string]map[string]string) error {
+		setRecord(records, taken, map[string]string{poolTagKey: poolClaimed, machineIdTagKey: "other"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := env.driver("m1")
+	d.SpotinstWarmPool = true
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	if *d.InstanceId != free {
+		t.Fatalf("machine has instance %v, want the unclaimed %v", *d.InstanceId, free)
+	}
+	if n := env.srv.Calls(spotinsttest.OpScaleUp); n != 2 {
+		t.Errorf("group was scaled up %v times, want only the 2 of the refill", n)
+	}
+
+	records := env.records(t)
+	if owner := records[taken][machineIdTagKey]; owner != "other" {
+		t.Errorf("claimed instance %v is recorded for machine %q, want other", taken, owner)
+	}
+	if r := records[free]; r[poolTagKey] != poolClaimed || r[machineIdTagKey] != d.Id {
+		t.Errorf("instance %v is recorded %v, want claimed by %v", free, formatTags(r), d.Id)
+	}
+}
+
+func TestRefillPool(t *testing.T) {
+	env := newTestEnv(t)
+	defer env.Close()
+
+	env.refill(t, 2)
+	if n := len(env.pool(t, poolUnclaimed)); n != 2 {
+		t.Fatalf("warm pool has %v instances after refill, want 2", n)
+	}
+
+	env.refill(t, 2)
+	if n := env.srv.Calls(spotinsttest.OpScaleUp); n != 2 {
+		t.Fatalf("group was scaled up %v times by a refill of a full pool, want 2 in all", n)
+	}
+
+	d := env.driver("m1")
+	d.SpotinstWarmPool = true
+	if err := d.Create(); err != nil {
+		t.Fatal(err)
+	}
+	env.refill(t, 2)
+	if n := env.srv.Calls(spotinsttest.OpScaleUp); n != 3 {
+		t.Errorf("group was scaled up %v times, want 3 after refilling the claimed instance", n)
+	}
+	if n := len(env.pool(t, poolUnclaimed)); n != 2 {
+		t.Errorf("warm pool has %v unclaimed instances, want 2", n)
+	}
+	if claimed := env.pool(t, poolClaimed); len(claimed) != 1 || claimed[0] != *d.InstanceId {
+		t.Errorf("claimed instances are %v, want [%v]", claimed, *d.InstanceId)
+	}
+}